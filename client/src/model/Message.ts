@@ -9,6 +9,7 @@ export const MessageKindEnum = {
 	context_change_reject: 'ctx-change-reject', // One of the parties rejects the change request with a given reason.
 	context_update_request: 'ctx-update-request', // Request the current context fron the server/client. Can be used to re-sync the context.
 	context_update: 'ctx-update', // Sent unilaterally or by request by either the server or the client to notify the other party of their current context state.
+	queue_update: 'queue-update', // The server tells a waiting client where it is in the queue.
 } as const;
 
 export type MessageKindEnumKeys = ValuesOf<typeof MessageKindEnum>;
@@ -36,6 +37,9 @@ export type StatusCodeEnumKeys = ValuesOf<typeof StatusCodeEnum>;
 export interface ContextItem {
 	key: ContextItemKeys;
 	value: string;
+	system?: string;
+	type?: string;
+	display?: string;
 }
 
 export interface MessageRejection {
@@ -50,16 +54,28 @@ export interface MessageError {
 
 export interface ConnectionInfo {
 	version: number;
+	max_version?: number;
 	application: string;
 	timeout?: number;
 	replace_exiting_client?: boolean;
+	capabilities?: string[];
+	role?: 'observer';
+}
+
+export interface QueueInfo {
+	position: number;
+	size: number;
+	status: 'next' | 'queued' | 'held';
 }
 
 export interface Message {
 	kind: MessageKindEnumKeys;
+	id?: string;
+	reply_to?: string;
 	info?: ConnectionInfo;
 	context?: ContextItem[];
 	current_context?: ContextItem[];
 	rejection?: MessageRejection;
 	error?: MessageError;
+	queue?: QueueInfo;
 }
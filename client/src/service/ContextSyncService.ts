@@ -5,6 +5,7 @@ import { StateEnum, StateEnumKeys } from '../model/State';
 export interface ContextSyncOptions {
 	url: string;
 	version: number;
+	maxVersion?: number; // The highest protocol version the application supports, version when omitted.
 	application: string;
 	onConnected: () => void;
 	onSynced: (rejectReason?: string, statusCode?: number) => void;
@@ -20,6 +21,7 @@ export class ContextSyncService {
 	private url: URL;
 	private port: string;
 	private version: number;
+	private maxVersion: number;
 	private application: string;
 	private debugMode: boolean;
 	private onConnectedCallback: () => void;
@@ -41,6 +43,7 @@ export class ContextSyncService {
 	constructor({
 		url,
 		version,
+		maxVersion,
 		application,
 		debugMode,
 		onConnected,
@@ -54,6 +57,7 @@ export class ContextSyncService {
 		this.url = new URL(url);
 		this.port = this.url.port;
 		this.version = version;
+		this.maxVersion = maxVersion ?? version;
 		this.application = application;
 		this.debugMode = debugMode ?? false;
 		this.onConnectedCallback = onConnected;
@@ -232,7 +236,8 @@ export class ContextSyncService {
 		this.send({
 			kind: MessageKindEnum.sync_request,
 			info: {
-				version: 1,
+				version: this.version,
+				max_version: this.maxVersion,
 				application: this.application,
 			},
 		});
@@ -5,7 +5,7 @@ pushd "%~dp0"
 go mod tidy
 if errorlevel 1 goto :fail
 
-go build -o techcyte_context_sync_host.exe cmd\tcs\main.go
+go build -o techcyte_context_sync_host.exe .\cmd\tcs
 if errorlevel 1 goto :fail
 
 echo Built techcyte_context_sync_host.exe
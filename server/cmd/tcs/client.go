@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Techcyte/context-sync/server/contextsync/client"
+	"github.com/Techcyte/context-sync/server/internal/clientapp"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gorilla/websocket"
+)
+
+// runClient runs "tcs client", a TUI that stands in for Fusion against any LIS server, and returns the exit code.
+func runClient(args []string) int {
+	flags := flag.NewFlagSet("client", flag.ExitOnError)
+	url := flags.String("url", "wss://localhost:4002/cm", "The LIS server's websocket URL")
+	application := flags.String("application", "Fusion", "Our application name, sent in the sync-request")
+	initialContext := flags.String("context", "", "Context to send in the sync-request, a case number or key=value, ...")
+	replace := flags.Bool("replace", false, "Ask the server to replace its synchronized client with us")
+	caFile := flags.String("ca", "", "A CA certificate to trust besides the system's, for example the demo server's ca.crt")
+	insecure := flags.Bool("insecure", false, "Don't verify the server's certificate")
+	flags.Parse(args)
+
+	dialer, err := newDialer(*caFile, *insecure)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	options := client.Options{
+		URL:         *url,
+		Application: *application,
+		Replace:     *replace,
+		Dialer:      dialer,
+	}
+	if *initialContext != "" {
+		options.Context, err = clientapp.ContextFromInput(*initialContext, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid context: %v\n", err)
+			return 1
+		}
+	}
+
+	app := clientapp.NewApp(options, client.DefaultBackoff)
+	_, err = tea.NewProgram(app, tea.WithAltScreen(), tea.WithMouseAllMotion()).Run()
+	app.Session.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// newDialer returns a websocket dialer that trusts the CA certificate in caFile as well as the system's, or that
+// doesn't verify certificates at all when insecure is set.
+func newDialer(caFile string, insecure bool) (*websocket.Dialer, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the CA certificate: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%v has no PEM certificates", caFile)
+		}
+		dialer.TLSClientConfig.RootCAs = roots
+	}
+
+	return &dialer, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	"github.com/Techcyte/context-sync/server/internal/conformance"
+)
+
+// runConformance runs "tcs conformance", which checks an LIS server against the scenarios in the protocol README, and
+// returns the exit code.
+func runConformance(args []string) int {
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	serverURL := flags.String("url", "wss://localhost:4002/cm", "The LIS server's websocket URL")
+	caFile := flags.String("ca", "", "A CA certificate to trust besides the system's, for example the demo server's ca.crt")
+	insecure := flags.Bool("insecure", false, "Don't verify the server's certificate")
+	control := flags.Bool("control", false, "Drive the demo server's /control API instead of asking you to act in the LIS")
+	noOperator := flags.Bool("no-operator", false, "Skip the scenarios that need someone to act in the LIS")
+	run := flags.String("run", "", "Only run the scenarios whose name matches this regular expression")
+	junit := flags.String("junit", "", "Write the results as JUnit XML to this file")
+	verbose := flags.Bool("v", false, "Print the transcript of every scenario, not only the failed ones")
+	timeout := flags.Duration("timeout", conformance.DEFAULT_TIMEOUT, "How long the server may take to answer a message")
+	wait := flags.Duration("wait", conformance.DEFAULT_WAIT, "How long to wait for the server after asking you to act in the LIS")
+	caseNumber := flags.String("case", "N123456", "A case the LIS can switch to")
+	otherCase := flags.String("other-case", "N654321", "Another case the LIS can switch to")
+	failCase := flags.String("fail-case", "N666", "A case the LIS fails to switch to, run the demo server with -fail-cases set to it")
+	flags.Parse(args)
+
+	dialer, err := newDialer(*caFile, *insecure)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	config := conformance.Config{
+		URL:       *serverURL,
+		Dialer:    dialer,
+		Operator:  conformance.PromptOperator{Out: os.Stderr},
+		Timeout:   *timeout,
+		Wait:      *wait,
+		Case:      *caseNumber,
+		OtherCase: *otherCase,
+		FailCase:  *failCase,
+	}
+
+	if *run != "" {
+		config.Run, err = regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -run: %v\n", err)
+			return 1
+		}
+	}
+
+	if *noOperator {
+		config.Operator = nil
+	} else if *control {
+		base, err := url.Parse(*serverURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -url: %v\n", err)
+			return 1
+		}
+		if base.Scheme == "ws" {
+			base.Scheme = "http"
+		} else {
+			base.Scheme = "https"
+		}
+		base.Path = ""
+
+		config.Operator = conformance.ControlOperator{
+			URL:    base.String(),
+			Client: &http.Client{Transport: &http.Transport{TLSClientConfig: dialer.TLSClientConfig}},
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results := conformance.Run(ctx, config, conformance.Scenarios)
+	conformance.WriteReport(os.Stdout, results, *verbose)
+
+	if *junit != "" {
+		file, err := os.Create(*junit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create the JUnit file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+
+		if err := conformance.WriteJUnit(file, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the JUnit file: %v\n", err)
+			return 1
+		}
+	}
+
+	if conformance.AnyFailed(results) {
+		return 1
+	}
+
+	return 0
+}
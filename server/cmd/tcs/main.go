@@ -1,25 +1,98 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
-	"tcs/internal/certs"
-	"tcs/internal/server"
+	"strings"
+	"syscall"
+
+	"github.com/Techcyte/context-sync/server/internal/certs"
+	"github.com/Techcyte/context-sync/server/internal/server"
+	"github.com/Techcyte/context-sync/server/internal/tui"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "client":
+			os.Exit(runClient(os.Args[2:]))
+		case "conformance":
+			os.Exit(runConformance(os.Args[2:]))
+		}
+	}
+
 	port := flag.String("port", "4002", "What port to use")
 	startingCase := flag.String("case", "N123456", "Starting case number")
 	autoAccept := flag.Bool("auto-accept", false, "If enabled the manager will auto accept context change requests")
+	onCollision := flag.String("on-collision", string(server.CollisionAsk), "How to answer a client request that crosses our own: ask, yield or reject")
+	onTakeover := flag.String("on-takeover", string(server.TakeoverWait), "What happens to the synchronized client when another client replaces it: wait, close or deny")
+	nextClient := flag.String("next-client", "fifo", "Which waiting client is synchronized next: fifo, recent, never or priority=App1,App2")
+	hub := flag.Bool("hub", false, "Act as a context hub: every client is a participant and changes are negotiated between all of them")
+	quorum := flag.String("quorum", string(server.QuorumAll), "In hub mode how many participants have to accept a change: all, majority or any")
+	failCases := flag.String("fail-cases", "", "Simulate the LIS failing to switch to these comma separated case numbers")
+	failRate := flag.Float64("fail-rate", 0, "Simulate the LIS failing to switch this fraction of the time, from 0 to 1")
+	acceptRules := flag.String("accept-rules", "", "A JSON file with rules that accept, reject or ask about client requests, see the README")
+	unsaved := flag.String("unsaved", "", "Simulate these comma separated fields having unsaved edits, which vetoes every context change")
+	lockedCases := flag.String("locked-cases", "", "Veto switching to locked cases, as comma separated CASE=user pairs")
+	casePatients := flag.String("case-patients", "", "Veto context whose patient doesn't match the case, as comma separated CASE=patient pairs")
+	contextKeys := flag.String("context-keys", "", "A JSON file with extra context keys to register, see the README")
+	strictKeys := flag.Bool("strict-keys", false, "If enabled context with unregistered keys is rejected")
+	system := flag.String("system", "", "Our system or assigning authority, added to context entered in the TUI")
+	headless := flag.Bool("headless", false, "Run without the TUI, for example as a background service or in CI")
+	logFile := flag.String("log-file", "", "In headless mode append the log to this file instead of stdout")
+	logFormat := flag.String("log-format", "text", "In headless mode the log format: text or json")
+	control := flag.Bool("control", false, "In headless mode serve the /control endpoints to drive the server over HTTP")
+	timeout := flag.Duration("timeout", server.DEFAULT_TIMEOUT, "How long a context change request may wait for an answer, 0 disables it")
 	flag.Parse()
 
+	collisionPolicy, err := server.ParseCollisionPolicy(*onCollision)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	takeoverPolicy, err := server.ParseTakeoverPolicy(*onTakeover)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	selectionPolicy, err := server.ParseSelectionPolicy(*nextClient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	quorumRule, err := server.ParseQuorumRule(*quorum)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	locks, err := server.ParseCaseValues(*lockedCases)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	patients, err := server.ParseCaseValues(*casePatients)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
 	// Generate and trust a self-signed cert if we don't have
-	// one yet. This runs before the TUI starts.
+	// one yet. This runs before the TUI starts. In headless mode
+	// there is nobody to press Enter so we don't wait.
 	if !certs.CertificatesExist(".") {
 		fmt.Println("No TLS certificate found. Generating a self-signed certificate...")
 	}
@@ -33,35 +106,140 @@ func main() {
 		if warning != nil {
 			fmt.Printf("Could not install the CA into the trust store automatically: %v", warning)
 			fmt.Printf("The server will still start, but you must trust %s manually. See the README.\n", certs.CACertFile)
-			fmt.Println("Press Enter to start.")
-			fmt.Scanln()
+			waitForEnter(*headless)
 		} else {
 			switch runtime.GOOS {
 			case "windows":
-				fmt.Printf("Installed %s into the trust store.\n", certs.CACertFile);
+				fmt.Printf("Installed %s into the trust store.\n", certs.CACertFile)
 			case "darwin":
 				fmt.Printf("Installed %s into the trust store. On macOS, open Keychain Access and set it to \"Always Trust\".\n", certs.CACertFile)
 			}
-			fmt.Println("Press Enter to start.")
-			fmt.Scanln()
+			waitForEnter(*headless)
 		}
 	}
 
 	address := fmt.Sprintf(":%v", *port)
 	manager := server.NewManager(address, *startingCase)
-	if autoAccept != nil {
-		manager.AutoAccept = *autoAccept
+	// The demo lets Fusion connect from wherever it is served.
+	manager.Upgrader.CheckOrigin = func(r *http.Request) bool {
+		return true
+	}
+	manager.AutoAccept = *autoAccept
+	manager.CollisionPolicy = collisionPolicy
+	manager.Timeout = *timeout
+	manager.TakeoverPolicy = takeoverPolicy
+	manager.SelectionPolicy = selectionPolicy
+	manager.Hub = *hub
+	manager.Quorum = quorumRule
+	if *failCases != "" || *failRate > 0 {
+		cases := []string{}
+		if *failCases != "" {
+			cases = strings.Split(*failCases, ",")
+		}
+		manager.Navigator = server.NewFakeNavigator(cases, *failRate)
+	}
+	if *unsaved != "" {
+		manager.Guards = append(manager.Guards, server.NewUnsavedGuard(strings.Split(*unsaved, ",")...))
+	}
+	if len(locks) > 0 {
+		manager.Guards = append(manager.Guards, server.CaseLockGuard{Locks: locks})
+	}
+	if len(patients) > 0 {
+		manager.Guards = append(manager.Guards, server.PatientMismatchGuard{Patients: patients})
+	}
+	if *acceptRules != "" {
+		manager.AcceptRules, err = server.LoadAcceptRules(*acceptRules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	manager.Keys.Strict = *strictKeys
+	manager.System = *system
+	if *contextKeys != "" {
+		err = manager.Keys.RegisterFile(*contextKeys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	go manager.ListenForDisconnect()
+	// The TUI, the control API and headless mode need more of the manager than the contextsync package exposes, so the
+	// demo server runs it directly.
+	go manager.Run()
 	http.HandleFunc("/cm", func(w http.ResponseWriter, r *http.Request) {
 		server.Serve(manager, w, r)
 	})
 
+	if *headless {
+		os.Exit(runHeadless(manager, *logFile, *logFormat, *control))
+	}
+
 	// Remove tea.WithAltScreen() to NewProgram() if you want to retain the text on screen after the program exits.
-	application := server.NewApp(manager)
+	srv := &http.Server{Addr: address}
+	application := tui.NewApp(manager, srv)
 	_, err = tea.NewProgram(application, tea.WithAltScreen(), tea.WithMouseAllMotion()).Run()
 	if err != nil {
 		panic(err)
 	}
+
+	fmt.Println("Shutting down")
+	if err := server.Shutdown(srv, manager); err != nil {
+		fmt.Fprintf(os.Stderr, "Shutdown did not finish cleanly: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func waitForEnter(headless bool) {
+	if headless {
+		return
+	}
+
+	fmt.Println("Press Enter to start.")
+	fmt.Scanln()
+}
+
+// runHeadless serves until SIGINT or SIGTERM and returns the exit code. Commands are read from stdin, see
+// server.Manager.RunCommand.
+func runHeadless(manager *server.Manager, logFile, logFormat string, control bool) int {
+	var output io.Writer = os.Stdout
+	if logFile != "" {
+		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open the log file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		output = file
+	}
+
+	var handler slog.Handler
+	switch logFormat {
+	case "text":
+		handler = slog.NewTextHandler(output, nil)
+	case "json":
+		handler = slog.NewJSONHandler(output, nil)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown log format '%v', expected text or json\n", logFormat)
+		return 1
+	}
+
+	if control {
+		http.Handle("/control/", server.ControlHandler(manager))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	headless := server.Headless{
+		Manager: manager,
+		Logger:  slog.New(handler),
+		Input:   os.Stdin,
+	}
+	if err := headless.Run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Server stopped: %v\n", err)
+		return 1
+	}
+
+	return 0
 }
@@ -0,0 +1,407 @@
+// Package client is a Go client for the context sync protocol, the equivalent of the TypeScript ContextSyncService in
+// client/src/service. It plays the part Fusion plays: it connects to an LIS, syncs, and switches context with it.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+const PROTOCOL_VERSION = 1.0
+const CLOSE_WAIT = time.Second // How long Close waits for the server to answer the close frame.
+
+var ErrNotSynced = errors.New("the client is not synchronized")
+var ErrEmptyContext = errors.New("no context")
+var ErrNoRequest = errors.New("there is no context change request to answer")
+
+// Options configures a client. Only URL and Application are required, the callbacks are all optional.
+type Options struct {
+	URL         string                    // The server's websocket URL, for example wss://localhost:4002/cm.
+	Application string                    // Our application name, sent in the sync-request.
+	Version     float64                   // The protocol version to ask for, PROTOCOL_VERSION when zero.
+	Context     []contextsync.ContextItem // The initial context sent in the sync-request. Optional.
+	Replace     bool                      // Ask the server to replace its synchronized client with us.
+	Dialer      *websocket.Dialer         // Used to connect, for example to trust a self-signed certificate. Optional.
+
+	OnConnected           func()                                                 // The websocket connected.
+	OnSynced              func(rejection *contextsync.MessageRejection)          // The server answered the sync-request, rejection is nil when it accepted. After a 419 the client waits to be synced, after other rejections it closes.
+	SwitchContext         func(context []contextsync.ContextItem)                // Switch to the context, the server and we agreed on it.
+	ContextSwitchRequest  func(context []contextsync.ContextItem)                // The server asks us to switch, answer with Accept or Reject.
+	ContextSwitchRejected func(reason string, context []contextsync.ContextItem) // The server rejected our request for the context.
+	OnClose               func()                                                 // The connection closed.
+	OnError               func(err *contextsync.MessageError)                    // The server reported an error, or sent something we don't understand.
+	OnSend                func(message contextsync.Message)                      // Every message we send, for logs and transcripts.
+	OnReceive             func(message contextsync.Message)                      // Every message we receive, for logs and transcripts.
+	OnReconnect           func(attempt int, delay time.Duration, err error)      // A Session reconnects after the delay. err is why the last attempt failed, nil when the connection dropped.
+}
+
+// Client is a connection to a context sync server. Its methods are safe to call from any goroutine, the callbacks
+// included. Callbacks are called one at a time from the goroutine reading the connection.
+type Client struct {
+	options Options
+	conn    *websocket.Conn
+	done    chan struct{}
+
+	writeMu sync.Mutex // Only one goroutine may write to the connection at a time.
+
+	mu                 sync.Mutex
+	active             bool                // The server accepted our sync-request.
+	context            []model.ContextItem // The context we are on.
+	request            *model.Message      // The server's ctx-change-request we haven't answered.
+	outstandingID      string              // The id of our ctx-change-request waiting for an answer.
+	outstandingContext []model.ContextItem
+}
+
+// Dial connects to the server and sends the sync-request. OnSynced is called with the server's answer.
+func Dial(ctx context.Context, options Options) (*Client, error) {
+	if options.Version == 0 {
+		options.Version = PROTOCOL_VERSION
+	}
+
+	dialer := options.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+
+	conn, _, err := dialer.DialContext(ctx, options.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %v: %w", options.URL, err)
+	}
+
+	c := &Client{
+		options: options,
+		conn:    conn,
+		done:    make(chan struct{}),
+		context: toModelContext(options.Context),
+	}
+
+	if options.OnConnected != nil {
+		options.OnConnected()
+	}
+
+	request := util.NewSubRequestMessage(options.Application, options.Version, options.Replace)
+	request.Context = toModelContext(options.Context)
+	if err := c.send(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.read()
+	return c, nil
+}
+
+// RequestContextChange asks the server to switch to the context. SwitchContext is called when it accepts and
+// ContextSwitchRejected when it rejects.
+func (c *Client) RequestContextChange(context []contextsync.ContextItem) error {
+	if len(context) == 0 {
+		return ErrEmptyContext
+	}
+
+	c.mu.Lock()
+	if !c.active {
+		c.mu.Unlock()
+		return ErrNotSynced
+	}
+
+	request := util.NewCtxChangeMessage(toModelContext(context))
+	request.ID = util.NewMessageID()
+	c.outstandingID = request.ID
+	c.outstandingContext = toModelContext(context)
+	c.mu.Unlock()
+
+	return c.send(request)
+}
+
+// Accept accepts the server's context change request and calls SwitchContext.
+func (c *Client) Accept() error {
+	c.mu.Lock()
+	request := c.request
+	if request == nil {
+		c.mu.Unlock()
+		return ErrNoRequest
+	}
+
+	c.request = nil
+	c.context = util.CopyContext(request.Context)
+	c.mu.Unlock()
+
+	if c.options.SwitchContext != nil {
+		c.options.SwitchContext(fromModelContext(request.Context))
+	}
+
+	accept := util.NewCtxAcceptMessage(util.CopyContext(request.Context))
+	accept.ReplyTo = request.ID
+	return c.send(accept)
+}
+
+// Reject rejects the server's context change request with the reason and status, for example "The doodad field has
+// not been saved." and 409.
+func (c *Client) Reject(reason string, status contextsync.StatusCode) error {
+	c.mu.Lock()
+	request := c.request
+	if request == nil {
+		c.mu.Unlock()
+		return ErrNoRequest
+	}
+
+	c.request = nil
+	current := util.CopyContext(c.context)
+	c.mu.Unlock()
+
+	reject := util.NewCtxRejectMessage(current, request.Context, reason, model.StatusCode(status))
+	reject.ReplyTo = request.ID
+	return c.send(reject)
+}
+
+// SendUpdate tells the server we are now on the context, for example after the user navigated on their own.
+func (c *Client) SendUpdate(context []contextsync.ContextItem) error {
+	c.mu.Lock()
+	if !c.active {
+		c.mu.Unlock()
+		return ErrNotSynced
+	}
+	c.context = toModelContext(context)
+	c.mu.Unlock()
+
+	return c.send(util.NewCtxUpdateMessage(toModelContext(context)))
+}
+
+// RequestUpdate asks the server for its current context. SwitchContext is called with it.
+func (c *Client) RequestUpdate() error {
+	return c.send(model.Message{Kind: model.ContextUpdateRequest})
+}
+
+// Close sends a close frame and waits up to CLOSE_WAIT for the server to close the connection, after that the
+// connection is dropped. OnClose is called either way.
+func (c *Client) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	c.writeMu.Lock()
+	err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(CLOSE_WAIT))
+	c.writeMu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-time.After(CLOSE_WAIT):
+		c.conn.Close()
+	}
+
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return nil
+	}
+
+	return err
+}
+
+// Done is closed once the connection closed and OnClose returned.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// IsActive reports whether the server accepted our sync-request and the connection is open.
+func (c *Client) IsActive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// Context returns the context we are on.
+func (c *Client) Context() []contextsync.ContextItem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fromModelContext(c.context)
+}
+
+// Pending returns the context of the server's request we haven't answered, or nil.
+func (c *Client) Pending() []contextsync.ContextItem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.request == nil {
+		return nil
+	}
+	return fromModelContext(c.request.Context)
+}
+
+func (c *Client) send(message model.Message) error {
+	if message.ID == "" {
+		message.ID = util.NewMessageID()
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("sending %v: %w", message.Kind, err)
+	}
+
+	c.writeMu.Lock()
+	err = c.conn.WriteMessage(websocket.TextMessage, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("sending %v: %w", message.Kind, err)
+	}
+
+	// Called without the write lock, so OnSend may send too.
+	if c.options.OnSend != nil {
+		c.options.OnSend(decodeMessage(data))
+	}
+
+	return nil
+}
+
+func (c *Client) read() {
+	defer func() {
+		c.conn.Close()
+		c.mu.Lock()
+		c.active = false
+		c.request = nil
+		c.outstandingID = ""
+		c.mu.Unlock()
+
+		if c.options.OnClose != nil {
+			c.options.OnClose()
+		}
+		close(c.done)
+	}()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var message model.Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.fail(fmt.Sprintf("Invalid message: %v", err), model.BadRequest)
+			continue
+		}
+
+		if c.options.OnReceive != nil {
+			c.options.OnReceive(decodeMessage(data))
+		}
+		c.handleMessage(message)
+	}
+}
+
+func (c *Client) handleMessage(message model.Message) {
+	switch message.Kind {
+	case model.SyncAccept:
+		c.mu.Lock()
+		c.active = true
+		if len(message.Context) > 0 {
+			c.context = util.CopyContext(message.Context)
+		}
+		c.mu.Unlock()
+
+		if c.options.OnSynced != nil {
+			c.options.OnSynced(nil)
+		}
+		if len(message.Context) > 0 {
+			c.switchContext(message.Context)
+		}
+	case model.SyncReject:
+		c.mu.Lock()
+		c.active = false
+		c.mu.Unlock()
+
+		rejection := message.Rejection
+		if rejection == nil {
+			rejection = &model.MessageRejection{Reason: "Unknown reason.", Status: model.Conflict}
+		}
+		if c.options.OnSynced != nil {
+			c.options.OnSynced(fromModelRejection(rejection))
+		}
+
+		// With a 419 the server may sync us later, so we wait. Anything else means it never will.
+		if rejection.Status != model.ConflictWithRetry {
+			go c.Close()
+		}
+	case model.ContextChangeRequest:
+		c.mu.Lock()
+		c.request = &message
+		c.mu.Unlock()
+
+		if c.options.ContextSwitchRequest != nil {
+			c.options.ContextSwitchRequest(fromModelContext(message.Context))
+		}
+	case model.ContextChangeAccept:
+		c.mu.Lock()
+		// Without reply_to the accept answers whatever we asked, but it must answer something.
+		if c.outstandingID == "" || (message.ReplyTo != "" && message.ReplyTo != c.outstandingID) {
+			c.mu.Unlock()
+			c.fail(fmt.Sprintf("Ignored a ctx-change-accept for request '%v', which isn't outstanding", message.ReplyTo), model.BadRequest)
+			return
+		}
+		context := c.outstandingContext
+		if len(message.Context) > 0 {
+			context = message.Context
+		}
+		c.context = util.CopyContext(context)
+		c.outstandingID = ""
+		c.outstandingContext = nil
+		c.mu.Unlock()
+
+		c.switchContext(context)
+	case model.ContextChangeReject:
+		c.mu.Lock()
+		context := c.outstandingContext
+		c.outstandingID = ""
+		c.outstandingContext = nil
+		c.mu.Unlock()
+
+		reason := "Unknown reason."
+		if message.Rejection != nil {
+			reason = message.Rejection.Reason
+		}
+		if c.options.ContextSwitchRejected != nil {
+			c.options.ContextSwitchRejected(reason, fromModelContext(context))
+		}
+	case model.ContextUpdate:
+		if message.Error != nil && c.options.OnError != nil {
+			c.options.OnError(fromModelError(message.Error))
+		}
+
+		c.mu.Lock()
+		if message.ReplyTo != "" && message.ReplyTo == c.outstandingID {
+			c.outstandingID = ""
+			c.outstandingContext = nil
+		}
+		changed := len(message.Context) > 0 && !util.ContextEqual(message.Context, c.context)
+		if changed {
+			c.context = util.CopyContext(message.Context)
+		}
+		c.mu.Unlock()
+
+		if changed {
+			c.switchContext(message.Context)
+		}
+	case model.QueueUpdate:
+		// We don't list the queue-position capability, so the server shouldn't send these.
+	default:
+		c.fail(fmt.Sprintf("Unknown message kind '%v'", message.Kind), model.BadRequest)
+	}
+}
+
+func (c *Client) switchContext(context []model.ContextItem) {
+	if c.options.SwitchContext != nil {
+		c.options.SwitchContext(fromModelContext(context))
+	}
+}
+
+func (c *Client) fail(message string, status model.StatusCode) {
+	if c.options.OnError != nil {
+		c.options.OnError(&contextsync.MessageError{Message: message, Status: contextsync.StatusCode(status)})
+	}
+}
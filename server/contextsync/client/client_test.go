@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+func caseContext(caseNumber string) []contextsync.ContextItem {
+	return []contextsync.ContextItem{{Key: contextsync.CaseNumber, Value: caseNumber}}
+}
+
+// events collects what the callbacks were called with so the tests can wait for it.
+type events struct {
+	synced   chan *contextsync.MessageRejection
+	switched chan []contextsync.ContextItem
+	requests chan []contextsync.ContextItem
+	rejected chan string
+	errors   chan *contextsync.MessageError
+	closed   chan struct{}
+}
+
+func newEvents() *events {
+	return &events{
+		synced:   make(chan *contextsync.MessageRejection, 10),
+		switched: make(chan []contextsync.ContextItem, 10),
+		requests: make(chan []contextsync.ContextItem, 10),
+		rejected: make(chan string, 10),
+		errors:   make(chan *contextsync.MessageError, 10),
+		closed:   make(chan struct{}, 10),
+	}
+}
+
+func (e *events) options(url string, context []contextsync.ContextItem) Options {
+	return Options{
+		URL:                   url,
+		Application:           "Go client",
+		Context:               context,
+		OnSynced:              func(rejection *contextsync.MessageRejection) { e.synced <- rejection },
+		SwitchContext:         func(context []contextsync.ContextItem) { e.switched <- context },
+		ContextSwitchRequest:  func(context []contextsync.ContextItem) { e.requests <- context },
+		ContextSwitchRejected: func(reason string, context []contextsync.ContextItem) { e.rejected <- reason },
+		OnError:               func(err *contextsync.MessageError) { e.errors <- err },
+		OnClose:               func() { e.closed <- struct{}{} },
+	}
+}
+
+func wait[T any](t *testing.T, c chan T) T {
+	t.Helper()
+	select {
+	case value := <-c:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a callback")
+		var zero T
+		return zero
+	}
+}
+
+func newServer(t *testing.T, options ...contextsync.Option) (*contextsync.Server, string) {
+	t.Helper()
+	cs, err := contextsync.New(append([]contextsync.Option{contextsync.WithInitialContext(caseContext("N1"))}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(cs)
+	t.Cleanup(func() {
+		httpServer.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		cs.Shutdown(ctx)
+	})
+
+	return cs, "ws" + strings.TrimPrefix(httpServer.URL, "http") + cs.Path()
+}
+
+func dial(t *testing.T, options Options) *Client {
+	t.Helper()
+	c, err := Dial(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSyncWithInitialContext(t *testing.T) {
+	cs, url := newServer(t)
+	e := newEvents()
+	c := dial(t, e.options(url, caseContext("N2")))
+
+	if rejection := wait(t, e.synced); rejection != nil {
+		t.Fatalf("expected to sync, got %+v", rejection)
+	}
+	if switched := wait(t, e.switched); switched[0].Value != "N2" || !c.IsActive() {
+		t.Fatalf("expected to switch to our initial context, got %v", switched)
+	}
+	if current := cs.Context(); current[0].Value != "N2" {
+		t.Fatalf("expected the server to switch to N2, got %v", current)
+	}
+}
+
+func TestServerRequests(t *testing.T) {
+	cs, url := newServer(t)
+	e := newEvents()
+	c := dial(t, e.options(url, nil))
+	wait(t, e.synced)
+	wait(t, e.switched)
+
+	cs.ProposeContext(caseContext("N2"))
+	if request := wait(t, e.requests); request[0].Value != "N2" {
+		t.Fatalf("expected to be asked to switch to N2, got %v", request)
+	}
+	if err := c.Reject("The doodad field has not been saved.", contextsync.Conflict); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); cs.Snapshot().Outstanding; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the server to get our rejection")
+		}
+	}
+
+	cs.ProposeContext(caseContext("N3"))
+	wait(t, e.requests)
+	if err := c.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	if switched := wait(t, e.switched); switched[0].Value != "N3" {
+		t.Fatalf("expected to switch to N3, got %v", switched)
+	}
+	if err := c.Accept(); err != ErrNoRequest {
+		t.Fatalf("expected nothing left to accept, got %v", err)
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	cs, url := newServer(t, contextsync.WithAcceptRules(contextsync.AcceptRule{
+		Name:    "same-patient",
+		Action:  contextsync.RuleReject,
+		Changes: []contextsync.ContextKey{contextsync.Patient},
+		Reason:  "Wrong patient.",
+	}), contextsync.WithAutoAccept())
+	e := newEvents()
+	c := dial(t, e.options(url, nil))
+
+	if err := c.RequestContextChange(caseContext("N2")); err != ErrNotSynced {
+		t.Fatalf("expected requests before syncing to fail, got %v", err)
+	}
+	wait(t, e.synced)
+	wait(t, e.switched)
+
+	if err := c.RequestContextChange(caseContext("N2")); err != nil {
+		t.Fatal(err)
+	}
+	if switched := wait(t, e.switched); switched[0].Value != "N2" || cs.Context()[0].Value != "N2" {
+		t.Fatalf("expected to switch to N2, got %v", switched)
+	}
+
+	if err := c.RequestContextChange([]contextsync.ContextItem{{Key: contextsync.Patient, Value: "p-2"}, {Key: contextsync.CaseNumber, Value: "N3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if reason := wait(t, e.rejected); reason != "Wrong patient." {
+		t.Fatalf("expected the rule's rejection, got %v", reason)
+	}
+}
+
+func TestSecondClientIsRejected(t *testing.T) {
+	_, url := newServer(t)
+	first := newEvents()
+	dial(t, first.options(url, nil))
+	wait(t, first.synced)
+
+	second := newEvents()
+	c := dial(t, second.options(url, nil))
+	if rejection := wait(t, second.synced); rejection == nil || rejection.Status != contextsync.ConflictWithRetry || c.IsActive() {
+		t.Fatalf("expected a 419, got %+v", rejection)
+	}
+
+	c.Close()
+	wait(t, second.closed)
+}
+
+func TestUnsolicitedAcceptIsIgnored(t *testing.T) {
+	url, _ := scriptedServer(t, func(connection int, conn *websocket.Conn, request model.Message) {
+		syncAccept(conn, request, util.ContextFromCaseNumber("N1"))
+		accept := util.NewCtxAcceptMessage(nil)
+		accept.ReplyTo = "not-ours"
+		conn.WriteJSON(accept)
+		conn.WriteJSON(util.NewCtxAcceptMessage(nil))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	e := newEvents()
+	c := dial(t, e.options(url, nil))
+	wait(t, e.synced)
+	wait(t, e.switched)
+
+	if err := wait(t, e.errors); !strings.Contains(err.Message, "not-ours") {
+		t.Fatalf("expected the unsolicited accept to be reported, got %+v", err)
+	}
+	wait(t, e.errors)
+	if current := c.Context(); len(current) != 1 || current[0].Value != "N1" {
+		t.Fatalf("expected the context to stay on N1, got %v", current)
+	}
+	select {
+	case switched := <-e.switched:
+		t.Fatalf("expected no switch, got %v", switched)
+	default:
+	}
+}
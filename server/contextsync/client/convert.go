@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+// The client keeps its state in the server's message model and hands the contextsync types to its users.
+
+func toModelContext(context []contextsync.ContextItem) []model.ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	items := make([]model.ContextItem, len(context))
+	for i, item := range context {
+		items[i] = model.ContextItem{Key: model.ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display}
+	}
+	return items
+}
+
+func fromModelContext(context []model.ContextItem) []contextsync.ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	items := make([]contextsync.ContextItem, len(context))
+	for i, item := range context {
+		items[i] = contextsync.ContextItem{Key: contextsync.ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display}
+	}
+	return items
+}
+
+func fromModelRejection(rejection *model.MessageRejection) *contextsync.MessageRejection {
+	if rejection == nil {
+		return nil
+	}
+	return &contextsync.MessageRejection{Reason: rejection.Reason, Status: contextsync.StatusCode(rejection.Status)}
+}
+
+func fromModelError(err *model.MessageError) *contextsync.MessageError {
+	if err == nil {
+		return nil
+	}
+	return &contextsync.MessageError{Message: err.Message, Status: contextsync.StatusCode(err.Status)}
+}
+
+// decodeMessage decodes a message as it went over the websocket, for OnSend and OnReceive. The wire format is the
+// same for both models.
+func decodeMessage(data []byte) contextsync.Message {
+	var message contextsync.Message
+	json.Unmarshal(data, &message)
+	return message
+}
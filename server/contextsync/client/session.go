@@ -0,0 +1,287 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+)
+
+var ErrNotConnected = errors.New("the session is not connected")
+var ErrRejected = errors.New("the server rejected the sync-request")
+
+// Backoff is how long a Session waits between reconnects. The delay starts at Initial and is multiplied by Multiplier
+// after every failed attempt up to Max. Jitter spreads reconnecting clients out so they don't all hit a restarted
+// server at once: the delay is shortened by a random fraction of up to Jitter. Initial, Max and Multiplier that aren't
+// set are taken from DefaultBackoff, so a zero Backoff never redials in a tight loop.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64 // From 0 to 1.
+}
+
+// DefaultBackoff is what Fusion does: start after half a second and back off to at most 30 seconds.
+var DefaultBackoff = Backoff{Initial: 500 * time.Millisecond, Max: 30 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+// Delay is the delay before the attempt, counting from 0, with random from 0 to 1 choosing the jitter.
+func (b Backoff) Delay(attempt int, random float64) time.Duration {
+	if b.Initial <= 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Multiplier <= 0 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+
+	delay := float64(b.Initial)
+	for range attempt {
+		delay *= b.Multiplier
+		if delay >= float64(b.Max) {
+			break
+		}
+	}
+
+	delay = min(delay, float64(b.Max))
+	return time.Duration(delay * (1 - b.Jitter*random))
+}
+
+// Session is a Client that reconnects, for unattended clients like kiosks. When the connection drops it reconnects
+// after a backoff and sends the context it was on in the sync-request, so the server picks up where it left off. After
+// a sync-reject with a 419 it stays connected and waits to be synced. After any other sync-reject, a 409 included, the
+// server will never sync it, so the session ends and Err returns why.
+type Session struct {
+	options Options
+	backoff Backoff
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu       sync.Mutex
+	client   *Client                   // The current connection, nil while reconnecting.
+	context  []contextsync.ContextItem // The context we were on when the last connection closed.
+	closed   bool
+	stopOnce sync.Once
+	err      error
+}
+
+// Connect starts a session and returns right away, the first connection is made in the background like every
+// reconnect. The session runs until Close is called, ctx is done or the server rejects it for good.
+func Connect(ctx context.Context, options Options, backoff Backoff) *Session {
+	s := &Session{
+		options: options,
+		backoff: backoff,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		context: options.Context,
+	}
+
+	go s.run(ctx)
+	return s
+}
+
+func (s *Session) run(ctx context.Context) {
+	defer close(s.done)
+
+	attempt := 0
+	for {
+		synced, rejection, err := s.connect(ctx)
+		if rejection != nil {
+			s.setErr(fmt.Errorf("%w: %v (%v)", ErrRejected, rejection.Reason, rejection.Status))
+			return
+		}
+		if synced {
+			attempt = 0
+		}
+
+		if s.isClosed() || ctx.Err() != nil {
+			return
+		}
+
+		delay := s.backoff.Delay(attempt, rand.Float64())
+		attempt++
+		if s.options.OnReconnect != nil {
+			s.options.OnReconnect(attempt, delay, err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connect dials and waits until the connection closes. It reports whether the server synced us, the rejection that
+// ends the session if there was one, and why the connection couldn't be made.
+func (s *Session) connect(ctx context.Context) (synced bool, rejection *contextsync.MessageRejection, err error) {
+	var mu sync.Mutex
+	options := s.options
+	options.Context = s.lastContext()
+	options.OnSynced = func(r *contextsync.MessageRejection) {
+		mu.Lock()
+		if r == nil || r.Status == contextsync.ConflictWithRetry {
+			synced = true
+		} else {
+			rejection = r
+		}
+		mu.Unlock()
+
+		if s.options.OnSynced != nil {
+			s.options.OnSynced(r)
+		}
+	}
+
+	client, err := Dial(ctx, options)
+	if err != nil {
+		return false, nil, err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		client.Close()
+		return false, nil, nil
+	}
+	s.client = client
+	s.mu.Unlock()
+
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		client.Close()
+	}
+
+	s.mu.Lock()
+	s.client = nil
+	if current := client.Context(); len(current) > 0 {
+		s.context = current
+	}
+	s.mu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return synced, rejection, nil
+}
+
+func (s *Session) current() (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil, ErrNotConnected
+	}
+	return s.client, nil
+}
+
+func (s *Session) lastContext() []contextsync.ContextItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.context
+}
+
+func (s *Session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Session) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// RequestContextChange asks the server to switch to the context, see Client.RequestContextChange.
+func (s *Session) RequestContextChange(context []contextsync.ContextItem) error {
+	client, err := s.current()
+	if err != nil {
+		return err
+	}
+	return client.RequestContextChange(context)
+}
+
+// Accept accepts the server's context change request, see Client.Accept.
+func (s *Session) Accept() error {
+	client, err := s.current()
+	if err != nil {
+		return err
+	}
+	return client.Accept()
+}
+
+// Reject rejects the server's context change request, see Client.Reject.
+func (s *Session) Reject(reason string, status contextsync.StatusCode) error {
+	client, err := s.current()
+	if err != nil {
+		return err
+	}
+	return client.Reject(reason, status)
+}
+
+// SendUpdate tells the server we are now on the context, see Client.SendUpdate.
+func (s *Session) SendUpdate(context []contextsync.ContextItem) error {
+	client, err := s.current()
+	if err != nil {
+		return err
+	}
+	return client.SendUpdate(context)
+}
+
+// IsActive reports whether the session is connected and synchronized.
+func (s *Session) IsActive() bool {
+	client, err := s.current()
+	return err == nil && client.IsActive()
+}
+
+// Context returns the context we are on.
+func (s *Session) Context() []contextsync.ContextItem {
+	if client, err := s.current(); err == nil {
+		return client.Context()
+	}
+	return s.lastContext()
+}
+
+// Pending returns the context of the server's request we haven't answered, or nil.
+func (s *Session) Pending() []contextsync.ContextItem {
+	if client, err := s.current(); err == nil {
+		return client.Pending()
+	}
+	return nil
+}
+
+// Close ends the session and closes the connection, if there is one.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	client := s.client
+	s.mu.Unlock()
+
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+
+	<-s.done
+	return err
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended on its own, nil while it runs or after Close.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
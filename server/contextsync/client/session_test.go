@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+var testBackoff = Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		attempt int
+		random  float64
+		delay   time.Duration
+	}{
+		{0, 0, time.Second},
+		{1, 0, 2 * time.Second},
+		{3, 0, 8 * time.Second},
+		{4, 0, 10 * time.Second},
+		{100, 0, 10 * time.Second},
+		{1, 1, time.Second},
+		{4, 0.5, 7500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		if delay := backoff.Delay(test.attempt, test.random); delay != test.delay {
+			t.Fatalf("attempt %v with random %v: expected %v, got %v", test.attempt, test.random, test.delay, delay)
+		}
+	}
+}
+
+func TestZeroBackoffUsesDefaults(t *testing.T) {
+	var backoff Backoff
+	if delay := backoff.Delay(0, 0); delay != DefaultBackoff.Initial {
+		t.Fatalf("expected the first delay to be %v, got %v", DefaultBackoff.Initial, delay)
+	}
+	if delay := backoff.Delay(100, 0); delay != DefaultBackoff.Max {
+		t.Fatalf("expected the delay to back off to %v, got %v", DefaultBackoff.Max, delay)
+	}
+}
+
+// scriptedServer reads the sync-request of every connection and hands it to script with the connection's number,
+// counting from 0.
+func scriptedServer(t *testing.T, script func(connection int, conn *websocket.Conn, request model.Message)) (url string, connections *atomic.Int32) {
+	t.Helper()
+	connections = &atomic.Int32{}
+	upgrader := websocket.Upgrader{}
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var request model.Message
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+
+		script(int(connections.Add(1))-1, conn, request)
+	}))
+	t.Cleanup(httpServer.Close)
+
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http"), connections
+}
+
+func syncAccept(conn *websocket.Conn, request model.Message, context []model.ContextItem) {
+	accept := util.NewSubAcceptMessage("server", 1, nil, context)
+	accept.ReplyTo = request.ID
+	conn.WriteJSON(accept)
+}
+
+func TestSessionReconnectsWithItsContext(t *testing.T) {
+	requests := make(chan model.Message, 10)
+	url, _ := scriptedServer(t, func(connection int, conn *websocket.Conn, request model.Message) {
+		requests <- request
+		syncAccept(conn, request, nil)
+		if connection == 0 {
+			// Switch the client to N2, then drop the connection.
+			change := util.NewCtxChangeMessage(util.ContextFromCaseNumber("N2"))
+			change.ID = "change-1"
+			conn.WriteJSON(change)
+			var accept model.Message
+			conn.ReadJSON(&accept)
+			return
+		}
+
+		conn.ReadMessage() // Stay connected until the client closes.
+	})
+
+	reconnects := make(chan error, 10)
+	e := newEvents()
+	options := e.options(url, caseContext("N1"))
+	options.OnReconnect = func(attempt int, delay time.Duration, err error) { reconnects <- err }
+	var session atomic.Pointer[Session]
+	options.ContextSwitchRequest = func(context []contextsync.ContextItem) { session.Load().Accept() }
+	session.Store(Connect(context.Background(), options, testBackoff))
+	defer session.Load().Close()
+
+	if first := wait(t, requests); util.FormatContext(first.Context) != "case=N1" {
+		t.Fatalf("expected the first sync-request to carry N1, got %v", first.Context)
+	}
+	if err := wait(t, reconnects); err != nil {
+		t.Fatalf("expected the dropped connection to reconnect, got %v", err)
+	}
+	if second := wait(t, requests); util.FormatContext(second.Context) != "case=N2" {
+		t.Fatalf("expected the second sync-request to carry N2, got %v", second.Context)
+	}
+}
+
+func TestSessionStaysConnectedAfter419(t *testing.T) {
+	url, connections := scriptedServer(t, func(connection int, conn *websocket.Conn, request model.Message) {
+		reject := util.NewSubRejectMessage("server", 1, nil, "Already have a synchronized client.", model.ConflictWithRetry)
+		reject.ReplyTo = request.ID
+		conn.WriteJSON(reject)
+
+		time.Sleep(50 * time.Millisecond)
+		syncAccept(conn, request, util.ContextFromCaseNumber("N3"))
+		conn.ReadMessage()
+	})
+
+	e := newEvents()
+	session := Connect(context.Background(), e.options(url, nil), testBackoff)
+	defer session.Close()
+
+	if rejection := wait(t, e.synced); rejection == nil || rejection.Status != contextsync.ConflictWithRetry {
+		t.Fatalf("expected a 419, got %+v", rejection)
+	}
+	if rejection := wait(t, e.synced); rejection != nil {
+		t.Fatalf("expected to be synced later on the same connection, got %+v", rejection)
+	}
+	if !session.IsActive() || connections.Load() != 1 {
+		t.Fatalf("expected one active connection, got %v", connections.Load())
+	}
+}
+
+func TestSessionEndsAfter409(t *testing.T) {
+	url, connections := scriptedServer(t, func(connection int, conn *websocket.Conn, request model.Message) {
+		reject := util.NewSubRejectMessage("server", 1, nil, "Go away.", model.Conflict)
+		reject.ReplyTo = request.ID
+		conn.WriteJSON(reject)
+		conn.ReadMessage() // The client closes the connection.
+	})
+
+	session := Connect(context.Background(), newEvents().options(url, nil), testBackoff)
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the session to end")
+	}
+
+	if err := session.Err(); !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected the session to end rejected, got %v", err)
+	}
+	if connections.Load() != 1 {
+		t.Fatalf("expected no reconnect after a 409, got %v connections", connections.Load())
+	}
+}
+
+func TestSessionRetriesUntilTheServerIsUp(t *testing.T) {
+	reconnects := make(chan error, 10)
+	options := newEvents().options("ws://127.0.0.1:1/cm", nil)
+	options.OnReconnect = func(attempt int, delay time.Duration, err error) { reconnects <- err }
+
+	session := Connect(context.Background(), options, testBackoff)
+	for range 2 {
+		if err := wait(t, reconnects); err == nil {
+			t.Fatalf("expected the failed dial to be reported")
+		}
+	}
+
+	if err := session.Close(); err != nil || session.Err() != nil {
+		t.Fatalf("expected Close to end the session cleanly, got %v %v", err, session.Err())
+	}
+}
@@ -0,0 +1,192 @@
+// Package contextsync adds the Techcyte context sync protocol to an LIS written in Go. A Server is an http.Handler
+// that accepts Fusion's websocket connections, so it can be mounted on the LIS's own mux and served over its own TLS:
+//
+//	var cs *contextsync.Server
+//	cs, err := contextsync.New(
+//		contextsync.WithInitialContext(current),
+//		contextsync.WithNavigator(lisNavigator),
+//		contextsync.OnChangeRequest(func(request contextsync.ChangeRequest) {
+//			if reportIsSaved() {
+//				cs.Accept()
+//			} else {
+//				cs.Reject("Unsaved report.", contextsync.Conflict)
+//			}
+//		}),
+//	)
+//	mux.Handle(cs.Path(), cs)
+package contextsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Techcyte/context-sync/server/internal/events"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/server"
+)
+
+const DEFAULT_PATH = "/cm"
+
+// ChangeRequest is a client's context change request waiting for Accept or Reject.
+type ChangeRequest struct {
+	ClientID    string
+	Application string
+	Context     []ContextItem
+}
+
+// Server serves the context sync protocol. Create it with New.
+type Server struct {
+	path    string
+	manager *server.Manager
+
+	onChangeRequest  func(ChangeRequest)
+	onContextChanged func([]ContextItem)
+	onEvent          func(Event)
+
+	subscriptions []*events.Subscription
+	wg            sync.WaitGroup
+}
+
+// New creates a server and starts its manager. Call Shutdown when done.
+func New(options ...Option) (*Server, error) {
+	config := defaultConfig()
+	for _, option := range options {
+		option(config)
+	}
+
+	if !strings.HasPrefix(config.path, "/") {
+		return nil, fmt.Errorf("invalid path '%v', it has to start with /", config.path)
+	}
+
+	manager := server.NewManagerWithContext(config.address, config.context)
+	for _, configure := range config.manager {
+		if err := configure(manager); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Server{
+		path:             config.path,
+		manager:          manager,
+		onChangeRequest:  config.onChangeRequest,
+		onContextChanged: config.onContextChanged,
+		onEvent:          config.onEvent,
+	}
+
+	if config.logger != nil {
+		s.listen(s.manager.Events.Subscribe(0), func(subscription *events.Subscription) {
+			events.Log(config.logger, subscription)
+		})
+	}
+	// The callbacks may wait for the user, they must not miss a change request while they do.
+	if s.onChangeRequest != nil || s.onContextChanged != nil || s.onEvent != nil {
+		s.listen(s.manager.Events.SubscribeLossless(), s.dispatch)
+	}
+
+	go manager.Run()
+	return s, nil
+}
+
+func (s *Server) listen(subscription *events.Subscription, run func(subscription *events.Subscription)) {
+	s.subscriptions = append(s.subscriptions, subscription)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		run(subscription)
+	}()
+}
+
+// dispatch calls the callbacks, one event at a time in the order they happened.
+func (s *Server) dispatch(subscription *events.Subscription) {
+	for internal := range subscription.C {
+		event := fromModelEvent(internal)
+		if s.onEvent != nil {
+			s.onEvent(event)
+		}
+
+		switch event.Kind {
+		case EventChangeRequested:
+			if s.onChangeRequest != nil {
+				s.onChangeRequest(ChangeRequest{ClientID: event.ClientID, Application: event.Application, Context: event.Context})
+			}
+		case EventContextChanged:
+			if s.onContextChanged != nil {
+				s.onContextChanged(event.Context)
+			}
+		}
+	}
+}
+
+// ServeHTTP upgrades requests for Path to a websocket connection with a client.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != s.path {
+		http.NotFound(w, r)
+		return
+	}
+
+	server.Serve(s.manager, w, r)
+}
+
+// Path is where the server expects clients to connect, DEFAULT_PATH unless WithPath changed it.
+func (s *Server) Path() string {
+	return s.path
+}
+
+// ProposeContext asks the synchronized client to change to the context. The answer arrives through OnContextChanged,
+// or not at all when the client rejects it. With no synchronized client the context changes right away. A guard's veto
+// is returned as a *VetoError.
+func (s *Server) ProposeContext(context []ContextItem) error {
+	if err := s.manager.Keys.Validate(toModelContext(context)); err != nil {
+		return err
+	}
+
+	err := s.manager.ContextChangeRequest(toModelContext(context))
+	var veto *server.VetoError
+	if errors.As(err, &veto) {
+		return &VetoError{Rejection: *fromModelRejection(&veto.Rejection)}
+	}
+	return err
+}
+
+// Accept accepts the client's context change request reported to OnChangeRequest.
+func (s *Server) Accept() {
+	s.manager.Accept()
+}
+
+// Reject rejects the client's context change request reported to OnChangeRequest with the reason and status the
+// client is sent.
+func (s *Server) Reject(reason string, status StatusCode) {
+	s.manager.RejectWithReason(reason, model.StatusCode(status))
+}
+
+// Promote makes a waiting client the synchronized client. With an empty clientID the selection policy picks one.
+func (s *Server) Promote(clientID string) {
+	s.manager.Promote(clientID)
+}
+
+// Context returns the current context.
+func (s *Server) Context() []ContextItem {
+	return fromModelContext(s.manager.Snapshot().Context)
+}
+
+// Snapshot returns a copy of the protocol state.
+func (s *Server) Snapshot() Snapshot {
+	return fromServerSnapshot(s.manager.Snapshot())
+}
+
+// Shutdown closes every client and waits until their queued messages are written or ctx is done, then stops the
+// server and waits for the callbacks to return. Shut down the http.Server first so no new clients connect.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.manager.Shutdown(ctx)
+
+	for _, subscription := range s.subscriptions {
+		subscription.Close()
+	}
+	s.wg.Wait()
+
+	return err
+}
@@ -0,0 +1,269 @@
+package contextsync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func caseContext(caseNumber string) []ContextItem {
+	return []ContextItem{{Key: CaseNumber, Value: caseNumber}}
+}
+
+// dial connects a websocket client to the server and syncs it.
+func dial(t *testing.T, httpServer *httptest.Server, path string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if answer := connect(t, conn, "Fusion"); answer.Kind != SyncAccept {
+		t.Fatalf("expected a sync-accept, got %+v", answer)
+	}
+
+	return conn
+}
+
+// connect sends the sync-request and returns the server's answer.
+func connect(t *testing.T, conn *websocket.Conn, application string) Message {
+	t.Helper()
+	send(t, conn, Message{Kind: SyncRequest, ID: "sync-" + application, Info: &ConnectionInfo{Version: 1, Application: application}})
+	return receive(t, conn)
+}
+
+func send(t *testing.T, conn *websocket.Conn, message Message) {
+	t.Helper()
+	if err := conn.WriteJSON(message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func shutdown(t *testing.T, cs *Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cs.Shutdown(ctx)
+}
+
+func TestChangeRequestCallback(t *testing.T) {
+	var cs *Server
+	requests := make(chan ChangeRequest, 1)
+	cs, err := New(
+		WithPath("/sync"),
+		WithInitialContext(caseContext("N1")),
+		OnChangeRequest(func(request ChangeRequest) {
+			requests <- request
+			cs.Reject("Unsaved report.", Conflict)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(cs)
+	defer httpServer.Close()
+	defer shutdown(t, cs)
+
+	conn := dial(t, httpServer, "/sync")
+	send(t, conn, Message{Kind: ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+
+	reject := receive(t, conn)
+	if reject.Kind != ContextChangeReject || reject.ReplyTo != "request-1" || reject.Rejection.Reason != "Unsaved report." {
+		t.Fatalf("expected the callback's rejection, got %+v", reject)
+	}
+	if request := <-requests; request.Application != "Fusion" || request.Context[0].Value != "N2" {
+		t.Fatalf("expected the callback to be told about the request, got %+v", request)
+	}
+	if current := cs.Context(); current[0].Value != "N1" {
+		t.Fatalf("expected to stay on N1, got %v", current)
+	}
+}
+
+func TestProposeContext(t *testing.T) {
+	changes := make(chan []ContextItem, 1)
+	cs, err := New(
+		WithInitialContext(caseContext("N1")),
+		OnContextChanged(func(context []ContextItem) {
+			changes <- context
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(cs)
+	defer httpServer.Close()
+	defer shutdown(t, cs)
+
+	conn := dial(t, httpServer, DEFAULT_PATH)
+	if err := cs.ProposeContext(caseContext("N2")); err != nil {
+		t.Fatal(err)
+	}
+
+	request := receive(t, conn)
+	if request.Kind != ContextChangeRequest || request.Context[0].Value != "N2" {
+		t.Fatalf("expected a ctx-change-request, got %+v", request)
+	}
+	send(t, conn, Message{Kind: ContextChangeAccept, ReplyTo: request.ID, Context: request.Context})
+
+	select {
+	case context := <-changes:
+		if context[0].Value != "N2" {
+			t.Fatalf("expected the context to change to N2, got %v", context)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected OnContextChanged to be called")
+	}
+}
+
+func TestProposeContextVetoed(t *testing.T) {
+	cs, err := New(WithGuards(GuardFunc(func(change ContextChange) *MessageRejection {
+		return &MessageRejection{Reason: "Unsaved report."}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(t, cs)
+
+	err = cs.ProposeContext(caseContext("N2"))
+	if veto, ok := err.(*VetoError); !ok || veto.Rejection.Reason != "Unsaved report." || veto.Rejection.Status != Conflict {
+		t.Fatalf("expected the veto as an error, got %v", err)
+	}
+	if len(cs.Context()) != 0 {
+		t.Fatalf("expected the context not to change, got %v", cs.Context())
+	}
+}
+
+func TestSlowCallbackMissesNothing(t *testing.T) {
+	const changes = 2 * 1024 // More than the event bus buffers for a subscriber.
+	release := make(chan struct{})
+	calls := make(chan struct{}, changes)
+	cs, err := New(OnContextChanged(func(context []ContextItem) {
+		<-release // The user takes a while to decide.
+		calls <- struct{}{}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(t, cs)
+
+	for i := range changes {
+		if err := cs.ProposeContext(caseContext(fmt.Sprintf("N%v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+
+	for i := range changes {
+		select {
+		case <-calls:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v calls, got %v", changes, i)
+		}
+	}
+}
+
+func TestServeHTTPChecksPath(t *testing.T) {
+	if _, err := New(WithPath("cm")); err == nil {
+		t.Fatalf("expected a path without a leading / to be rejected")
+	}
+
+	cs, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(t, cs)
+
+	recorder := httptest.NewRecorder()
+	cs.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected other paths to be 404, got %v", recorder.Code)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	cs, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(cs)
+	defer httpServer.Close()
+	defer shutdown(t, cs)
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + cs.Path()
+	header := http.Header{"Origin": {"https://fusion.example.com"}}
+	if _, _, err := websocket.DefaultDialer.Dial(url, header); err == nil {
+		t.Fatalf("expected another origin to be refused by default")
+	}
+
+	allowed, err := New(WithCheckOrigin(func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://fusion.example.com"
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedServer := httptest.NewServer(allowed)
+	defer allowedServer.Close()
+	defer shutdown(t, allowed)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(allowedServer.URL, "http")+allowed.Path(), header)
+	if err != nil {
+		t.Fatalf("expected the allowed origin to connect, got %v", err)
+	}
+	conn.Close()
+}
+
+// lastPolicy synchronizes the client that connected last, where FIFOPolicy would pick the first.
+type lastPolicy struct{}
+
+func (lastPolicy) Select(reason SelectionReason, candidates []Candidate) string {
+	return candidates[len(candidates)-1].ClientID
+}
+
+func TestSelectionPolicy(t *testing.T) {
+	cs, err := New(WithSelectionPolicy(lastPolicy{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(cs)
+	defer httpServer.Close()
+	defer shutdown(t, cs)
+
+	synced := dial(t, httpServer, DEFAULT_PATH)
+	waiting := map[string]*websocket.Conn{}
+	for _, application := range []string{"Viewer", "Fusion 2"} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+DEFAULT_PATH, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if answer := connect(t, conn, application); answer.Kind != SyncReject || answer.Rejection.Status != ConflictWithRetry {
+			t.Fatalf("expected %v to wait, got %+v", application, answer)
+		}
+		waiting[application] = conn
+	}
+
+	synced.Close()
+	if accept := receive(t, waiting["Fusion 2"]); accept.Kind != SyncAccept {
+		t.Fatalf("expected the client the policy picked to be synchronized, got %+v", accept)
+	}
+	snapshot := cs.Snapshot()
+	if snapshot.ClientCount != 2 || snapshot.Clients[0].State != ClientWaiting || snapshot.Clients[1].State != ClientSynced {
+		t.Fatalf("expected Fusion 2 to be synchronized and the Viewer to wait, got %+v", snapshot.Clients)
+	}
+}
@@ -0,0 +1,277 @@
+package contextsync
+
+import (
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/registry"
+	"github.com/Techcyte/context-sync/server/internal/server"
+)
+
+// The public types mirror the ones the tcs server uses internally. These convert between the two at the edge of the
+// package, so the internal ones can change without breaking embedders.
+
+func toModelContext(context []ContextItem) []model.ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	items := make([]model.ContextItem, len(context))
+	for i, item := range context {
+		items[i] = model.ContextItem{Key: model.ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display}
+	}
+	return items
+}
+
+func fromModelContext(context []model.ContextItem) []ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	items := make([]ContextItem, len(context))
+	for i, item := range context {
+		items[i] = ContextItem{Key: ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display}
+	}
+	return items
+}
+
+func toModelRejection(rejection *MessageRejection) *model.MessageRejection {
+	if rejection == nil {
+		return nil
+	}
+	return &model.MessageRejection{Reason: rejection.Reason, Status: model.StatusCode(rejection.Status)}
+}
+
+func fromModelRejection(rejection *model.MessageRejection) *MessageRejection {
+	if rejection == nil {
+		return nil
+	}
+	return &MessageRejection{Reason: rejection.Reason, Status: StatusCode(rejection.Status)}
+}
+
+func fromModelQueue(queue *model.QueueInfo) *QueueInfo {
+	if queue == nil {
+		return nil
+	}
+	return &QueueInfo{Position: queue.Position, Size: queue.Size, Status: QueueStatus(queue.Status)}
+}
+
+func fromModelMessage(message *model.Message) *Message {
+	if message == nil {
+		return nil
+	}
+
+	converted := &Message{
+		Kind:           MessageKind(message.Kind),
+		ID:             message.ID,
+		ReplyTo:        message.ReplyTo,
+		Context:        fromModelContext(message.Context),
+		CurrentContext: fromModelContext(message.CurrentContext),
+		Rejection:      fromModelRejection(message.Rejection),
+		Queue:          fromModelQueue(message.Queue),
+	}
+	if info := message.Info; info != nil {
+		converted.Info = &ConnectionInfo{
+			Version:              info.Version,
+			MaxVersion:           info.MaxVersion,
+			Application:          info.Application,
+			Timeout:              info.Timeout,
+			ReplaceExitingClient: info.ReplaceExitingClient,
+			Capabilities:         info.Capabilities,
+			Role:                 ClientRole(info.Role),
+		}
+	}
+	if message.Error != nil {
+		converted.Error = &MessageError{Message: message.Error.Message, Status: StatusCode(message.Error.Status)}
+	}
+	return converted
+}
+
+func fromModelEvent(event model.Event) Event {
+	return Event{
+		Kind:        EventKind(event.Kind),
+		Time:        event.Time,
+		ClientID:    event.ClientID,
+		Application: event.Application,
+		Message:     fromModelMessage(event.Message),
+		State:       ClientState(event.State),
+		Context:     fromModelContext(event.Context),
+		Text:        event.Text,
+		Err:         event.Err,
+	}
+}
+
+func fromServerDecision(decision *server.RuleDecision) *RuleDecision {
+	if decision == nil {
+		return nil
+	}
+
+	return &RuleDecision{
+		Rule:        decision.Rule,
+		Action:      RuleAction(decision.Action),
+		Result:      RuleResult(decision.Result),
+		Reason:      decision.Reason,
+		Context:     fromModelContext(decision.Context),
+		Application: decision.Application,
+	}
+}
+
+func fromServerSnapshot(snapshot server.Snapshot) Snapshot {
+	converted := Snapshot{
+		ClientCount:        snapshot.ClientCount,
+		Clients:            make([]ClientSnapshot, len(snapshot.Clients)),
+		Context:            fromModelContext(snapshot.Context),
+		Voting:             snapshot.Voting,
+		VoteContext:        fromModelContext(snapshot.VoteContext),
+		VoteRule:           snapshot.VoteRule,
+		LastDecision:       fromServerDecision(snapshot.LastDecision),
+		Outstanding:        snapshot.Outstanding,
+		OutstandingContext: fromModelContext(snapshot.OutstandingContext),
+		Collision:          snapshot.Collision,
+		Hub:                snapshot.Hub,
+	}
+	for i, client := range snapshot.Clients {
+		converted.Clients[i] = ClientSnapshot{
+			ID:          client.ID,
+			Application: client.Application,
+			State:       ClientState(client.State),
+			Queue:       fromModelQueue(client.Queue),
+		}
+	}
+	if negotiation := snapshot.Negotiation; negotiation != nil {
+		converted.Negotiation = &NegotiationSnapshot{
+			Context:    fromModelContext(negotiation.Context),
+			Originator: negotiation.Originator,
+			Accepted:   negotiation.Accepted,
+			Rejected:   negotiation.Rejected,
+			Pending:    negotiation.Pending,
+		}
+	}
+	return converted
+}
+
+func toServerRule(rule AcceptRule) server.AcceptRule {
+	converted := server.AcceptRule{
+		Name:        rule.Name,
+		Application: rule.Application,
+		OnlyChanges: toModelKeys(rule.OnlyChanges),
+		Changes:     toModelKeys(rule.Changes),
+		UnknownKeys: rule.UnknownKeys,
+		Action:      server.RuleAction(rule.Action),
+		Reason:      rule.Reason,
+		Status:      model.StatusCode(rule.Status),
+	}
+	if rule.Outside != nil {
+		converted.Outside = &server.TimeWindow{From: rule.Outside.From, To: rule.Outside.To}
+	}
+	return converted
+}
+
+func toModelKeys(keys []ContextKey) []model.ContextKey {
+	if keys == nil {
+		return nil
+	}
+
+	converted := make([]model.ContextKey, len(keys))
+	for i, key := range keys {
+		converted[i] = model.ContextKey(key)
+	}
+	return converted
+}
+
+func toRegistrySpec(spec KeySpec) registry.KeySpec {
+	return registry.KeySpec{
+		Key:       model.ContextKey(spec.Key),
+		Required:  spec.Required,
+		Pattern:   spec.Pattern,
+		MinLength: spec.MinLength,
+		MaxLength: spec.MaxLength,
+	}
+}
+
+// navigator lets the manager drive a public Navigator.
+type navigator struct {
+	navigator Navigator
+}
+
+func (n navigator) Navigate(context []model.ContextItem) error {
+	return n.navigator.Navigate(fromModelContext(context))
+}
+
+func (n navigator) Current() ([]model.ContextItem, error) {
+	current, err := n.navigator.Current()
+	return toModelContext(current), err
+}
+
+// guard lets the manager ask a public ContextChangeGuard.
+type guard struct {
+	guard ContextChangeGuard
+}
+
+func (g guard) Check(change server.ContextChange) *model.MessageRejection {
+	return toModelRejection(g.guard.Check(ContextChange{
+		From:        fromModelContext(change.From),
+		To:          fromModelContext(change.To),
+		Application: change.Application,
+	}))
+}
+
+// selectionPolicy lets the manager ask a public SelectionPolicy, it maps the ClientID it returns back to the client.
+type selectionPolicy struct {
+	policy SelectionPolicy
+}
+
+func (p selectionPolicy) Select(reason server.SelectionReason, candidates []server.Candidate) model.Client {
+	public := make([]Candidate, len(candidates))
+	for i, candidate := range candidates {
+		public[i] = Candidate{
+			ClientID:    candidate.Client.ID(),
+			Application: candidate.Client.Application(),
+			ConnectedAt: candidate.ConnectedAt,
+			LastActive:  candidate.LastActive,
+			Requested:   candidate.Requested,
+		}
+	}
+
+	id := p.policy.Select(SelectionReason(reason), public)
+	for _, candidate := range candidates {
+		if id != "" && candidate.Client.ID() == id {
+			return candidate.Client
+		}
+	}
+	return nil
+}
+
+// candidateClient stands in for a client when a built-in policy runs on public candidates. The policies only ask for
+// the ID and application.
+type candidateClient struct {
+	model.Client
+	id          string
+	application string
+}
+
+func (c candidateClient) ID() string {
+	return c.id
+}
+
+func (c candidateClient) Application() string {
+	return c.application
+}
+
+// selectWith runs one of the server's policies on public candidates, so the built-in policies behave the same either
+// way they are used.
+func selectWith(policy server.SelectionPolicy, reason SelectionReason, candidates []Candidate) string {
+	converted := make([]server.Candidate, len(candidates))
+	for i, candidate := range candidates {
+		converted[i] = server.Candidate{
+			Client:      candidateClient{id: candidate.ClientID, application: candidate.Application},
+			ConnectedAt: candidate.ConnectedAt,
+			LastActive:  candidate.LastActive,
+			Requested:   candidate.Requested,
+		}
+	}
+
+	client := policy.Select(server.SelectionReason(reason), converted)
+	if client == nil {
+		return ""
+	}
+	return client.ID()
+}
@@ -0,0 +1,182 @@
+package contextsync
+
+import (
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+// ContextKey names one item of the context.
+type ContextKey string
+
+const (
+	CaseNumber ContextKey = "case"
+	Patient    ContextKey = "patient"  // The patient MRN.
+	Order      ContextKey = "order"    // The order or accession number.
+	Specimen   ContextKey = "specimen" // The specimen id.
+	Block      ContextKey = "block"    // The block id.
+	Slide      ContextKey = "slide"    // The slide id.
+	User       ContextKey = "user"     // The id of the signed in user.
+)
+
+// ContextItem is one key of the context. System, Type and Display are optional and turn the value into a structured
+// identifier, so the same case number from two LIS instances can be told apart.
+type ContextItem struct {
+	Key     ContextKey `json:"key"`
+	Value   string     `json:"value"`
+	System  string     `json:"system,omitempty"`  // The system or assigning authority that issued the value.
+	Type    string     `json:"type,omitempty"`    // The kind of identifier, for example "accession" or "MRN".
+	Display string     `json:"display,omitempty"` // A label to show the user instead of the raw value.
+}
+
+// StatusCode is the status of a rejection or error, modelled on HTTP.
+type StatusCode int
+
+const (
+	OK                StatusCode = 200
+	BadRequest        StatusCode = 400
+	MethodNotAllowed  StatusCode = 405
+	RequestTimeout    StatusCode = 408
+	Conflict          StatusCode = 409
+	ConflictWithRetry StatusCode = 419
+	UpgradeRequired   StatusCode = 426
+	TooManyRequests   StatusCode = 429
+	ServerError       StatusCode = 500
+)
+
+func (status StatusCode) String() string {
+	return model.StatusCode(status).String()
+}
+
+// MessageKind is the kind of a protocol message.
+type MessageKind string
+
+const (
+	SyncRequest          MessageKind = "sync-request"
+	SyncAccept           MessageKind = "sync-accept"
+	SyncReject           MessageKind = "sync-reject"
+	ContextChangeRequest MessageKind = "ctx-change-request"
+	ContextChangeAccept  MessageKind = "ctx-change-accept"
+	ContextChangeReject  MessageKind = "ctx-change-reject"
+	ContextUpdateRequest MessageKind = "ctx-update-request"
+	ContextUpdate        MessageKind = "ctx-update"
+	QueueUpdate          MessageKind = "queue-update" // Sent to waiting clients that list CapabilityQueuePosition.
+)
+
+// Capabilities are optional features listed in the sync-request info. The server lists the ones it supports in its
+// sync-accept and sync-reject, a feature is only used when both sides list it.
+const (
+	CapabilityQueuePosition = "queue-position" // The client wants queue-update messages while it is waiting.
+)
+
+// Message is a protocol message as it is sent over the websocket.
+type Message struct {
+	Kind           MessageKind       `json:"kind"`
+	ID             string            `json:"id,omitempty"`
+	ReplyTo        string            `json:"reply_to,omitempty"`
+	Info           *ConnectionInfo   `json:"info,omitempty"`
+	Context        []ContextItem     `json:"context,omitempty"`
+	CurrentContext []ContextItem     `json:"current_context,omitempty"`
+	Rejection      *MessageRejection `json:"rejection,omitempty"`
+	Error          *MessageError     `json:"error,omitempty"`
+	Queue          *QueueInfo        `json:"queue,omitempty"`
+}
+
+type ConnectionInfo struct {
+	Version              float64    `json:"version"`
+	MaxVersion           *float64   `json:"max_version,omitempty"`
+	Application          string     `json:"application"`
+	Timeout              *float64   `json:"timeout,omitempty"`
+	ReplaceExitingClient *bool      `json:"replace_exiting_client,omitempty"`
+	Capabilities         []string   `json:"capabilities,omitempty"`
+	Role                 ClientRole `json:"role,omitempty"`
+}
+
+// ClientRole is what a client asks to be in its sync-request. Without a role the client wants to be the synchronized
+// client.
+type ClientRole string
+
+const (
+	RoleObserver ClientRole = "observer" // Follows the committed context through ctx-update messages but never changes it.
+)
+
+// QueueStatus is the server's estimate of when a waiting client will be synchronized.
+type QueueStatus string
+
+const (
+	QueueNext   QueueStatus = "next"   // The client is synchronized when the synchronized client leaves.
+	QueueQueued QueueStatus = "queued" // Other clients are ahead of this one.
+	QueueHeld   QueueStatus = "held"   // The server won't synchronize this client on its own, only a user can promote it.
+)
+
+type QueueInfo struct {
+	Position int         `json:"position"` // Starts at 1.
+	Size     int         `json:"size"`     // How many clients are waiting.
+	Status   QueueStatus `json:"status"`
+}
+
+type MessageRejection struct {
+	Reason string     `json:"reason"`
+	Status StatusCode `json:"status"`
+}
+
+type MessageError struct {
+	Message string     `json:"message"`
+	Status  StatusCode `json:"status"`
+}
+
+// ClientState is where a client is in the protocol from the server's point of view.
+type ClientState string
+
+const (
+	ClientConnected          ClientState = "connected"           // The websocket is open but no sync-request has been handled yet.
+	ClientSyncing            ClientState = "syncing"             // A sync-request is being handled.
+	ClientSynced             ClientState = "synced"              // The client is the synchronized client and nothing is outstanding.
+	ClientWaiting            ClientState = "waiting"             // The client was sent a sync-reject 419 and may be synchronized later.
+	ClientOutstandingRequest ClientState = "outstanding-request" // The server sent a ctx-change-request and is waiting for the client to answer it.
+	ClientVoting             ClientState = "voting"              // The client sent a ctx-change-request and the server has to accept or reject it.
+	ClientObserving          ClientState = "observing"           // The client is a read-only observer and is sent every committed context.
+	ClientClosing            ClientState = "closing"             // The server is closing the connection.
+)
+
+func (state ClientState) String() string {
+	return string(state)
+}
+
+// EventKind is what an Event is about.
+type EventKind string
+
+const (
+	EventClientConnected    EventKind = "client-connected"
+	EventClientDisconnected EventKind = "client-disconnected"
+	EventMessageSent        EventKind = "message-sent"
+	EventMessageReceived    EventKind = "message-received"
+	EventStateChanged       EventKind = "state-changed"
+	EventInfo               EventKind = "info"
+	EventError              EventKind = "error"
+	EventContextChanged     EventKind = "context-changed"  // The current context changed, for whatever reason.
+	EventChangeRequested    EventKind = "change-requested" // A client's context change request waits for an answer.
+	EventRuleDecided        EventKind = "rule-decided"     // An accept rule answered a client's context change request.
+)
+
+// Event is something that happened in the server, see OnEvent. Which fields are set depends on the kind.
+type Event struct {
+	Kind        EventKind
+	Time        time.Time
+	ClientID    string        // The client the event is about, if any.
+	Application string        // The application name of that client.
+	Message     *Message      // The message for message-sent and message-received.
+	State       ClientState   // The new state for state-changed.
+	Context     []ContextItem // The context for context-changed, change-requested and rule-decided.
+	Text        string        // A human readable description.
+	Err         error         // The error for error events, if there is one.
+}
+
+// KeySpec describes one context key and how its value is validated, see WithKeys.
+type KeySpec struct {
+	Key       ContextKey `json:"key"`
+	Required  bool       `json:"required,omitempty"`   // The key must be in every non-empty context.
+	Pattern   string     `json:"pattern,omitempty"`    // A regular expression the value must match.
+	MinLength int        `json:"min_length,omitempty"` // The minimum value length, zero means at least one character.
+	MaxLength int        `json:"max_length,omitempty"` // The maximum value length, zero means no limit.
+}
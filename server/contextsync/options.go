@@ -0,0 +1,248 @@
+package contextsync
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/server"
+)
+
+// Option configures a Server, see New.
+type Option func(*config)
+
+type config struct {
+	path    string
+	address string
+	context []model.ContextItem
+	manager []func(*server.Manager) error // Applied to the manager before it runs, in order.
+	logger  *slog.Logger
+
+	onChangeRequest  func(ChangeRequest)
+	onContextChanged func([]ContextItem)
+	onEvent          func(Event)
+}
+
+func defaultConfig() *config {
+	return &config{
+		path:    DEFAULT_PATH,
+		context: []model.ContextItem{},
+	}
+}
+
+func (c *config) configure(configure func(*server.Manager) error) {
+	c.manager = append(c.manager, configure)
+}
+
+// WithPath sets the path clients connect to, DEFAULT_PATH by default.
+func WithPath(path string) Option {
+	return func(c *config) {
+		c.path = path
+	}
+}
+
+// WithAddress sets the address shown in the log. The server doesn't listen on it, the http.Server serving it does.
+func WithAddress(address string) Option {
+	return func(c *config) {
+		c.address = address
+	}
+}
+
+// WithInitialContext sets the context the server starts with, what the LIS is showing. It is empty by default.
+func WithInitialContext(context []ContextItem) Option {
+	return func(c *config) {
+		c.context = toModelContext(context)
+	}
+}
+
+// WithTimeout sets how long a context change request may wait for an answer. Zero disables the deadline.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.Timeout = timeout
+			return nil
+		})
+	}
+}
+
+// WithAutoAccept accepts every client request no accept rule decides, without calling OnChangeRequest.
+func WithAutoAccept() Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.AutoAccept = true
+			return nil
+		})
+	}
+}
+
+// WithAcceptRules decides client requests before OnChangeRequest is called, the first matching rule wins.
+func WithAcceptRules(rules ...AcceptRule) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			for _, rule := range rules {
+				m.AcceptRules = append(m.AcceptRules, toServerRule(rule))
+			}
+			return nil
+		})
+	}
+}
+
+// WithAcceptRulesFile loads accept rules from a JSON file, the format the tcs command's -accept-rules flag reads.
+func WithAcceptRulesFile(path string) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			rules, err := server.LoadAcceptRules(path)
+			m.AcceptRules = append(m.AcceptRules, rules...)
+			return err
+		})
+	}
+}
+
+// WithGuards adds guards that can veto a context change before it is accepted or proposed.
+func WithGuards(guards ...ContextChangeGuard) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			for _, g := range guards {
+				m.Guards = append(m.Guards, guard{guard: g})
+			}
+			return nil
+		})
+	}
+}
+
+// WithNavigator switches the LIS when a context change is accepted. Without it every switch succeeds.
+func WithNavigator(n Navigator) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.Navigator = navigator{navigator: n}
+			return nil
+		})
+	}
+}
+
+// WithCollisionPolicy sets how to answer a client request that crosses our own, CollisionAsk by default.
+func WithCollisionPolicy(policy CollisionPolicy) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.CollisionPolicy = server.CollisionPolicy(policy)
+			return nil
+		})
+	}
+}
+
+// WithTakeoverPolicy sets what happens to the synchronized client when another client replaces it, TakeoverWait by
+// default.
+func WithTakeoverPolicy(policy TakeoverPolicy) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.TakeoverPolicy = server.TakeoverPolicy(policy)
+			return nil
+		})
+	}
+}
+
+// WithSelectionPolicy sets which waiting client is synchronized next, FIFOPolicy by default.
+func WithSelectionPolicy(policy SelectionPolicy) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.SelectionPolicy = selectionPolicy{policy: policy}
+			return nil
+		})
+	}
+}
+
+// WithHub makes every client a participant and negotiates changes between all of them with the quorum rule.
+func WithHub(quorum QuorumRule) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.Hub = true
+			m.Quorum = server.QuorumRule(quorum)
+			return nil
+		})
+	}
+}
+
+// WithKeys registers context keys, or changes the rules for a built in key. Fields a spec leaves at their zero value
+// keep what the key had.
+func WithKeys(specs ...KeySpec) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			for _, spec := range specs {
+				if err := m.Keys.Register(toRegistrySpec(spec)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// WithKeysFile registers the context keys in a JSON file, the format the tcs command's -context-keys flag reads.
+func WithKeysFile(path string) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			return m.Keys.RegisterFile(path)
+		})
+	}
+}
+
+// WithStrictKeys rejects context with keys that aren't registered.
+func WithStrictKeys() Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.Keys.Strict = true
+			return nil
+		})
+	}
+}
+
+// WithSystem sets our system or assigning authority.
+func WithSystem(system string) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.System = system
+			return nil
+		})
+	}
+}
+
+// WithCheckOrigin decides which web origins may connect. By default only pages served from the same host may, so
+// Fusion served from elsewhere needs its origin allowed here.
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) Option {
+	return func(c *config) {
+		c.configure(func(m *server.Manager) error {
+			m.Upgrader.CheckOrigin = checkOrigin
+			return nil
+		})
+	}
+}
+
+// WithLogger logs everything that happens, every message sent and received included.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// OnChangeRequest is called when a client asks to change the context and nothing else decided it, call Accept or
+// Reject to answer. Callbacks run one at a time on a goroutine of their own, so they may block for a while.
+func OnChangeRequest(callback func(ChangeRequest)) Option {
+	return func(c *config) {
+		c.onChangeRequest = callback
+	}
+}
+
+// OnContextChanged is called with the new context whenever it changes, whoever changed it.
+func OnContextChanged(callback func([]ContextItem)) Option {
+	return func(c *config) {
+		c.onContextChanged = callback
+	}
+}
+
+// OnEvent is called for everything that happens, see EventKind.
+func OnEvent(callback func(Event)) Option {
+	return func(c *config) {
+		c.onEvent = callback
+	}
+}
@@ -0,0 +1,182 @@
+package contextsync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/server"
+)
+
+// Navigator switches the LIS to a context, see WithNavigator.
+type Navigator interface {
+	// Navigate switches to the context or returns why it couldn't.
+	Navigate(context []ContextItem) error
+	// Current returns the context the LIS is showing, which after a failed Navigate may not be what we asked for.
+	Current() ([]ContextItem, error)
+}
+
+// ContextChange is a context change the guards are asked about.
+type ContextChange struct {
+	From        []ContextItem // The current context.
+	To          []ContextItem // The context we would switch to.
+	Application string        // The application that asked for the change, empty when ProposeContext did.
+}
+
+// ContextChangeGuard can veto a context change, for example because the user has an unsaved report open. The guards run
+// before a client's change is accepted, including the initial context in a sync-request, and before ProposeContext
+// sends a change. They are called on the server's goroutine so they should return quickly.
+type ContextChangeGuard interface {
+	// Check returns nil to allow the change, or the reason and status sent in the ctx-change-reject. A rejection
+	// without a status is sent as a 409.
+	Check(change ContextChange) *MessageRejection
+}
+
+// GuardFunc lets a plain function be used as a ContextChangeGuard.
+type GuardFunc func(change ContextChange) *MessageRejection
+
+func (f GuardFunc) Check(change ContextChange) *MessageRejection {
+	return f(change)
+}
+
+// VetoError is returned by ProposeContext when a guard vetoes the change.
+type VetoError struct {
+	Rejection MessageRejection
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("context change vetoed: %v", e.Rejection.Reason)
+}
+
+// RuleAction is what an accept rule does with a client's context change request.
+type RuleAction string
+
+const (
+	RuleAccept RuleAction = "accept" // Accept the request without calling OnChangeRequest.
+	RuleReject RuleAction = "reject" // Reject the request without calling OnChangeRequest.
+	RuleAsk    RuleAction = "ask"    // Call OnChangeRequest, even with WithAutoAccept.
+)
+
+// TimeWindow is a daily window in local time, "HH:MM" to "HH:MM". A window whose end is before its start spans midnight.
+type TimeWindow struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AcceptRule decides a client's context change request before OnChangeRequest is called. Every condition that is set
+// has to match, a rule without conditions matches every request.
+type AcceptRule struct {
+	Name        string       `json:"name"`
+	Application string       `json:"application,omitempty"`  // The request comes from this application.
+	OnlyChanges []ContextKey `json:"only_changes,omitempty"` // The request changes none but these keys.
+	Changes     []ContextKey `json:"changes,omitempty"`      // The request changes any of these keys.
+	UnknownKeys bool         `json:"unknown_keys,omitempty"` // The request has keys that aren't registered.
+	Outside     *TimeWindow  `json:"outside,omitempty"`      // The request arrives outside this window.
+	Action      RuleAction   `json:"action"`
+	Reason      string       `json:"reason,omitempty"` // Sent when the rule rejects. Optional.
+	Status      StatusCode   `json:"status,omitempty"` // Sent when the rule rejects, 409 when not set.
+}
+
+// RuleResult is what came of a request an accept rule answered.
+type RuleResult string
+
+const (
+	ResultAccepted         RuleResult = "accepted"
+	ResultRejected         RuleResult = "rejected"
+	ResultVetoed           RuleResult = "vetoed"            // The rule accepted but a guard vetoed the change.
+	ResultNavigationFailed RuleResult = "navigation-failed" // The rule accepted but the LIS couldn't switch.
+)
+
+// RuleDecision is a request an accept rule answered on its own.
+type RuleDecision struct {
+	Rule        string        `json:"rule"`
+	Action      RuleAction    `json:"action"`
+	Result      RuleResult    `json:"result"`
+	Reason      string        `json:"reason,omitempty"` // Why an accepted request was rejected after all.
+	Context     []ContextItem `json:"context"`
+	Application string        `json:"application"`
+}
+
+// CollisionPolicy is how to answer a client's context change request that crosses one of ours.
+type CollisionPolicy string
+
+const (
+	CollisionAsk    CollisionPolicy = "ask"    // Call OnChangeRequest.
+	CollisionYield  CollisionPolicy = "yield"  // Accept the client's request. The client rejects ours with a 409.
+	CollisionReject CollisionPolicy = "reject" // Reject the client's request with a 409. Both sides end up out of sync.
+)
+
+// TakeoverPolicy is what happens to the synchronized client when another client asks to replace it.
+type TakeoverPolicy string
+
+const (
+	TakeoverWait  TakeoverPolicy = "wait"  // The requester is synchronized, the replaced client is sent a 419 and waits.
+	TakeoverClose TakeoverPolicy = "close" // The requester is synchronized, the replaced client is sent a 409 and closed.
+	TakeoverDeny  TakeoverPolicy = "deny"  // replace_exiting_client is ignored and the requester is sent a 419.
+)
+
+// QuorumRule is how many participants have to accept a change in hub mode, see WithHub.
+type QuorumRule string
+
+const (
+	QuorumAll      QuorumRule = "all"      // Every other participant has to accept, any rejection rolls the change back.
+	QuorumMajority QuorumRule = "majority" // More than half of the other participants have to accept.
+	QuorumAny      QuorumRule = "any"      // One acceptance is enough.
+)
+
+// SelectionReason is why the server is looking for a client to synchronize.
+type SelectionReason string
+
+const (
+	SelectOnDisconnect SelectionReason = "disconnect" // The synchronized client disconnected.
+	SelectOnTakeover   SelectionReason = "takeover"   // A client sent replace_exiting_client in its sync-request.
+	SelectOnPromote    SelectionReason = "promote"    // Promote was called.
+)
+
+// Candidate is a client that could be synchronized.
+type Candidate struct {
+	ClientID    string
+	Application string
+	ConnectedAt time.Time
+	LastActive  time.Time // When the client last sent a message.
+	Requested   bool      // The client asked to be synchronized, or Promote picked it.
+}
+
+// SelectionPolicy picks the next synchronized client. Candidates are in the order they connected and there is at least
+// one. It returns the ClientID of one of them, or an empty string to leave no client synchronized or deny the
+// takeover.
+type SelectionPolicy interface {
+	Select(reason SelectionReason, candidates []Candidate) string
+}
+
+// FIFOPolicy synchronizes the client that has been waiting the longest.
+type FIFOPolicy struct{}
+
+func (FIFOPolicy) Select(reason SelectionReason, candidates []Candidate) string {
+	return selectWith(server.FIFOPolicy{}, reason, candidates)
+}
+
+// MostRecentlyActivePolicy synchronizes the client that sent a message most recently, it is most likely the one the
+// user is looking at.
+type MostRecentlyActivePolicy struct{}
+
+func (MostRecentlyActivePolicy) Select(reason SelectionReason, candidates []Candidate) string {
+	return selectWith(server.MostRecentlyActivePolicy{}, reason, candidates)
+}
+
+// PriorityPolicy synchronizes the client whose application comes first in Applications. Applications that aren't
+// listed come after the listed ones, clients with the same priority are taken in the order they connected.
+type PriorityPolicy struct {
+	Applications []string
+}
+
+func (p PriorityPolicy) Select(reason SelectionReason, candidates []Candidate) string {
+	return selectWith(server.PriorityPolicy{Applications: p.Applications}, reason, candidates)
+}
+
+// NeverPolicy never synchronizes a client on its own. Takeovers are still honored and Promote can pick a waiting
+// client.
+type NeverPolicy struct{}
+
+func (NeverPolicy) Select(reason SelectionReason, candidates []Candidate) string {
+	return selectWith(server.NeverPolicy{}, reason, candidates)
+}
@@ -0,0 +1,34 @@
+package contextsync
+
+// ClientSnapshot describes a connected client.
+type ClientSnapshot struct {
+	ID          string      `json:"id"`
+	Application string      `json:"application"`
+	State       ClientState `json:"state"`
+	Queue       *QueueInfo  `json:"queue,omitempty"` // Set while the client is waiting.
+}
+
+// NegotiationSnapshot describes a context change being negotiated in hub mode.
+type NegotiationSnapshot struct {
+	Context    []ContextItem `json:"context"`
+	Originator string        `json:"originator"` // The originator's application, empty when we proposed it.
+	Accepted   int           `json:"accepted"`
+	Rejected   int           `json:"rejected"`
+	Pending    int           `json:"pending"`
+}
+
+// Snapshot is a copy of the protocol state, see Server.Snapshot.
+type Snapshot struct {
+	ClientCount        int                  `json:"client_count"`
+	Clients            []ClientSnapshot     `json:"clients"` // In the order they connected.
+	Context            []ContextItem        `json:"context"`
+	Voting             bool                 `json:"voting"` // A client's request waits for Accept or Reject.
+	VoteContext        []ContextItem        `json:"vote_context,omitempty"`
+	VoteRule           string               `json:"vote_rule,omitempty"`     // The accept rule that asked about the request.
+	LastDecision       *RuleDecision        `json:"last_decision,omitempty"` // The last request an accept rule answered on its own.
+	Outstanding        bool                 `json:"outstanding"`             // Our request waits for the client's answer.
+	OutstandingContext []ContextItem        `json:"outstanding_context,omitempty"`
+	Collision          bool                 `json:"collision"`
+	Hub                bool                 `json:"hub"`
+	Negotiation        *NegotiationSnapshot `json:"negotiation,omitempty"`
+}
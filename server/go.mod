@@ -1,4 +1,4 @@
-module tcs
+module github.com/Techcyte/context-sync/server
 
 go 1.25.1
 
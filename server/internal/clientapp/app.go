@@ -0,0 +1,335 @@
+// Package clientapp is the TUI for "tcs client", a stand-in for Fusion that connects to any LIS server so it can be
+// tested without a browser. It mirrors the server's TUI in package tui.
+package clientapp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/contextsync/client"
+	"github.com/Techcyte/context-sync/server/internal/events"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/tui"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const REJECT_REASON = "User rejected context change."
+
+type App struct {
+	Session   *client.Session
+	URL       string
+	Events    *events.Subscription
+	Spinner   spinner.Model
+	Viewport  viewport.Model
+	TextInput textinput.Model
+	Messages  []string
+	State     State // The session state as of the last update.
+	Quitting  bool
+	Ready     bool
+	Err       error
+}
+
+// State is what the TUI shows about the session.
+type State struct {
+	Active  bool
+	Context []contextsync.ContextItem
+	Pending []contextsync.ContextItem // The server's request we haven't answered.
+	Ended   error                     // Why the session ended, nil while it runs.
+}
+
+// NewApp connects to the server in options.URL with a session that reconnects with the backoff. The options'
+// callbacks are replaced, everything that happens is logged in the TUI instead.
+func NewApp(options client.Options, backoff client.Backoff) App {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("202"))
+
+	input := textinput.New()
+	input.Placeholder = "Case number or key=value, ..."
+	input.CharLimit = 256
+	input.Width = 32
+
+	bus := events.NewBus()
+	subscription := bus.Subscribe(0)
+	session := client.Connect(context.Background(), withLogging(options, bus), backoff)
+
+	return App{
+		Session:   session,
+		URL:       options.URL,
+		Events:    subscription,
+		Spinner:   s,
+		TextInput: input,
+		Messages:  []string{},
+	}
+}
+
+// withLogging sets the options' callbacks to publish what happens on the bus, in the same events the server's TUI
+// shows.
+func withLogging(options client.Options, bus *events.Bus) client.Options {
+	url := options.URL
+	info := func(format string, a ...any) {
+		bus.Publish(model.Event{Kind: model.EventInfo, Text: fmt.Sprintf(format, a...)})
+	}
+
+	options.OnConnected = func() {
+		bus.Publish(model.Event{Kind: model.EventClientConnected, Application: url})
+	}
+	options.OnClose = func() {
+		bus.Publish(model.Event{Kind: model.EventClientDisconnected, Application: url})
+	}
+	options.OnSend = func(message contextsync.Message) {
+		bus.Publish(model.Event{Kind: model.EventMessageSent, Application: url, Message: toModelMessage(message)})
+	}
+	options.OnReceive = func(message contextsync.Message) {
+		bus.Publish(model.Event{Kind: model.EventMessageReceived, Application: url, Message: toModelMessage(message)})
+	}
+	options.OnSynced = func(rejection *contextsync.MessageRejection) {
+		if rejection == nil {
+			info("\033[92mSynchronized\033[0m")
+		} else if rejection.Status == contextsync.ConflictWithRetry {
+			info("\033[93mWaiting to be synchronized\033[0m: %v (%v)", rejection.Reason, rejection.Status)
+		} else {
+			info("\033[91mSync rejected\033[0m: %v (%v)", rejection.Reason, rejection.Status)
+		}
+	}
+	options.SwitchContext = func(public []contextsync.ContextItem) {
+		context := toModelContext(public)
+		bus.Publish(model.Event{Kind: model.EventContextChanged, Context: context, Text: fmt.Sprintf("Context changed to '%v'", util.FormatContext(context))})
+	}
+	options.ContextSwitchRequest = func(public []contextsync.ContextItem) {
+		context := toModelContext(public)
+		bus.Publish(model.Event{Kind: model.EventChangeRequested, Context: context, Text: fmt.Sprintf("Server asks to change context to '%v'", util.FormatContext(context))})
+	}
+	options.ContextSwitchRejected = func(reason string, context []contextsync.ContextItem) {
+		info("Server rejected '%v': %v", util.FormatContext(toModelContext(context)), reason)
+	}
+	options.OnError = func(err *contextsync.MessageError) {
+		bus.Publish(model.Event{Kind: model.EventError, Text: fmt.Sprintf("%v (%v)", err.Message, err.Status)})
+	}
+	options.OnReconnect = func(attempt int, delay time.Duration, err error) {
+		if err != nil {
+			info("\033[2mReconnecting in %v, attempt %v: %v\033[0m", delay.Round(time.Millisecond), attempt, err)
+			return
+		}
+		info("\033[2mReconnecting in %v\033[0m", delay.Round(time.Millisecond))
+	}
+
+	return options
+}
+
+func (app App) Init() tea.Cmd {
+	return tea.Batch(app.Spinner.Tick, textinput.Blink)
+}
+
+func (app App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	const heightOffset = 9
+	inPutFocused := app.TextInput.Focused()
+	app.State = app.Snapshot()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			if !inPutFocused {
+				app.Quitting = true
+				return app, tea.Quit
+			}
+		case "c":
+			if !inPutFocused {
+				app.ClearLog()
+				return app, nil
+			}
+		case "n":
+			if !inPutFocused {
+				app.TextInput.Focus()
+				return app, nil
+			}
+		case "a":
+			if !inPutFocused && app.State.Pending != nil {
+				app.printErr(app.Session.Accept(), "error accepting")
+				return app, nil
+			}
+		case "r":
+			if !inPutFocused && app.State.Pending != nil {
+				app.printErr(app.Session.Reject(REJECT_REASON, contextsync.Conflict), "error rejecting")
+				return app, nil
+			}
+		case "esc":
+			app.TextInput.Blur()
+			return app, nil
+		case "enter":
+			if app.TextInput.Focused() {
+				context, err := ContextFromInput(app.TextInput.Value(), app.State.Context)
+				app.TextInput.SetValue("")
+				app.TextInput.Blur()
+				if err != nil {
+					app.printErr(err, "error invalid context")
+					break
+				}
+
+				app.printErr(app.Session.RequestContextChange(context), "error requesting context change")
+			}
+
+			return app, nil
+		}
+	case tea.WindowSizeMsg:
+		if !app.Ready {
+			app.Viewport = viewport.New(msg.Width, msg.Height-heightOffset)
+			app.Viewport.YPosition = 6
+			app.Viewport.SetContent("")
+			app.Ready = true
+		} else {
+			app.Viewport.Width = msg.Width
+			app.Viewport.Height = msg.Height - heightOffset
+		}
+	case error:
+		app.Err = msg
+		return app, nil
+	}
+
+	if app.DrainMessages() {
+		app.Viewport.SetContent(strings.Join(app.Messages, "\n"))
+		app.Viewport.GotoBottom()
+	}
+
+	cmds := []tea.Cmd{}
+	var cmd tea.Cmd
+
+	app.Spinner, cmd = app.Spinner.Update(msg)
+	cmds = append(cmds, cmd)
+
+	app.Viewport, cmd = app.Viewport.Update(msg)
+	cmds = append(cmds, cmd)
+
+	app.TextInput, cmd = app.TextInput.Update(msg)
+	cmds = append(cmds, cmd)
+
+	return app, tea.Batch(cmds...)
+}
+
+func (app App) View() string {
+	if app.Err != nil {
+		return app.Err.Error()
+	}
+
+	status := "connecting"
+	if app.State.Ended != nil {
+		status = fmt.Sprintf("\033[91mended\033[0m: %v", app.State.Ended)
+	} else if app.State.Active {
+		status = "\033[92msynchronized\033[0m"
+	}
+
+	str := fmt.Sprintf("\n\t⚡️ Context sync client for %v %v", app.URL, app.Spinner.View())
+	str = fmt.Sprintf("%v\t\tRequest context %v", str, app.TextInput.View())
+
+	if app.State.Pending != nil {
+		str = fmt.Sprintf("%v\tServer wants to change context to '%v'. accept <a> * reject <r>\n", str, util.FormatContext(toModelContext(app.State.Pending)))
+	} else {
+		str = fmt.Sprintf("%v\n", str)
+	}
+
+	str = fmt.Sprintf("%v\tStatus: %v", str, status)
+	str = fmt.Sprintf("%v\t\t\t\tCurrent context: '%v'\n\n", str, util.FormatContext(toModelContext(app.State.Context)))
+
+	for i := 0; i < app.Viewport.Width; i++ {
+		str = fmt.Sprintf("%v─", str)
+	}
+
+	str = fmt.Sprintf("\n%v\n%v\n", str, app.Viewport.View())
+
+	controls := "clear <c> * request context <n> * quit <q>"
+	lineLen := app.Viewport.Width - len(controls) - 2
+	for range lineLen / 2 {
+		str = fmt.Sprintf("%v─", str)
+	}
+
+	str = fmt.Sprintf("%v┤\033[32m%v\033[0m├", str, controls)
+
+	for range lineLen / 2 {
+		str = fmt.Sprintf("%v─", str)
+	}
+
+	if app.Quitting {
+		return str + "\n"
+	}
+
+	return str
+}
+
+// Snapshot returns the session's state.
+func (app App) Snapshot() State {
+	state := State{
+		Active:  app.Session.IsActive(),
+		Context: app.Session.Context(),
+		Pending: app.Session.Pending(),
+	}
+
+	select {
+	case <-app.Session.Done():
+		state.Ended = app.Session.Err()
+		if state.Ended == nil {
+			state.Ended = fmt.Errorf("closed")
+		}
+	default:
+	}
+
+	return state
+}
+
+// DrainMessages moves the events published since the last update into the log. It reports whether there were any.
+func (app *App) DrainMessages() bool {
+	drained := false
+	for {
+		select {
+		case event := <-app.Events.C:
+			msg := fmt.Sprintf("%v: %v", len(app.Messages)+1, tui.FormatEvent(event))
+			app.Messages = append(app.Messages, msg)
+			drained = true
+		default:
+			return drained
+		}
+	}
+}
+
+func (app *App) ClearLog() {
+	app.Viewport.SetContent("")
+	app.Messages = []string{}
+}
+
+// printErr adds the error to the log, if there is one.
+func (app *App) printErr(err error, text string) {
+	if err == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("%v: %v", len(app.Messages)+1, tui.FormatEvent(model.Event{Kind: model.EventError, Text: text, Err: err}))
+	app.Messages = append(app.Messages, msg)
+	app.Viewport.SetContent(strings.Join(app.Messages, "\n"))
+	app.Viewport.GotoBottom()
+}
+
+// ContextFromInput turns user input into the context to request, like server.Manager.ContextFromInput: a bare case
+// number keeps the rest of the current context and only replaces the case. The context isn't validated, checking it
+// is the server's job and a stand-in should be able to send whatever the user typed.
+func ContextFromInput(input string, current []contextsync.ContextItem) ([]contextsync.ContextItem, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("no context entered")
+	}
+
+	if strings.Contains(input, "=") {
+		context, err := util.ParseContext(input)
+		return fromModelContext(context), err
+	}
+
+	return fromModelContext(util.WithContextValue(toModelContext(current), model.CaseNumber, input)), nil
+}
@@ -0,0 +1,80 @@
+package clientapp
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/contextsync/client"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestContextFromInput(t *testing.T) {
+	current := []contextsync.ContextItem{{Key: contextsync.Patient, Value: "p-1"}, {Key: contextsync.CaseNumber, Value: "N1"}}
+
+	context, err := ContextFromInput(" N2 ", current)
+	if err != nil || util.FormatContext(toModelContext(context)) != "patient=p-1, case=N2" {
+		t.Fatalf("expected a bare case number to keep the patient, got %v %v", context, err)
+	}
+
+	context, err = ContextFromInput("case=N3, unknown=!", current)
+	if err != nil || util.FormatContext(toModelContext(context)) != "case=N3, unknown=!" {
+		t.Fatalf("expected key=value input to replace the context unvalidated, got %v %v", context, err)
+	}
+
+	if _, err := ContextFromInput("  ", current); err == nil {
+		t.Fatalf("expected empty input to fail")
+	}
+}
+
+// eventually runs update until check passes.
+func eventually(t *testing.T, app App, check func(App) bool) App {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		model, _ := app.Update(nil)
+		app = model.(App)
+		if check(app) {
+			return app
+		}
+	}
+
+	t.Fatalf("timed out, the log is:\n%v", strings.Join(app.Messages, "\n"))
+	return app
+}
+
+func TestAcceptServerRequest(t *testing.T) {
+	cs, err := contextsync.New(contextsync.WithInitialContext([]contextsync.ContextItem{{Key: contextsync.CaseNumber, Value: "N1"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(cs)
+	defer httpServer.Close()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		cs.Shutdown(ctx)
+	}()
+
+	app := NewApp(client.Options{
+		URL:         "ws" + strings.TrimPrefix(httpServer.URL, "http") + cs.Path(),
+		Application: "Fusion",
+	}, client.DefaultBackoff)
+	defer app.Session.Close()
+
+	app = eventually(t, app, func(app App) bool { return app.State.Active })
+	cs.ProposeContext([]contextsync.ContextItem{{Key: contextsync.CaseNumber, Value: "N2"}})
+	app = eventually(t, app, func(app App) bool { return app.State.Pending != nil })
+
+	model, _ := app.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	app = eventually(t, model.(App), func(app App) bool { return util.FormatContext(toModelContext(app.State.Context)) == "case=N2" })
+
+	log := strings.Join(app.Messages, "\n")
+	if !strings.Contains(log, "'ctx-change-request'") || !strings.Contains(log, "'ctx-change-accept'") || !strings.Contains(log, `"kind": "ctx-change-accept"`) {
+		t.Fatalf("expected the log to show both messages with their payloads, got:\n%v", log)
+	}
+}
@@ -0,0 +1,42 @@
+package clientapp
+
+import (
+	"encoding/json"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+// The client hands out the contextsync types, the TUI shows them with the server's helpers and events.
+
+func toModelContext(context []contextsync.ContextItem) []model.ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	items := make([]model.ContextItem, len(context))
+	for i, item := range context {
+		items[i] = model.ContextItem{Key: model.ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display}
+	}
+	return items
+}
+
+func fromModelContext(context []model.ContextItem) []contextsync.ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	items := make([]contextsync.ContextItem, len(context))
+	for i, item := range context {
+		items[i] = contextsync.ContextItem{Key: contextsync.ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display}
+	}
+	return items
+}
+
+// toModelMessage converts through JSON, the wire format is the same for both models.
+func toModelMessage(message contextsync.Message) *model.Message {
+	var converted model.Message
+	data, _ := json.Marshal(message)
+	json.Unmarshal(data, &converted)
+	return &converted
+}
@@ -0,0 +1,410 @@
+// Package conformance checks an LIS server against the scenarios in the protocol README. It plays the client's part
+// with a script per scenario and keeps a transcript of every message, so a failure shows what the server sent.
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/server"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+const APPLICATION_NAME = "Conformance"
+const DEFAULT_TIMEOUT = 5 * time.Second
+const DEFAULT_WAIT = time.Minute
+const SETTLE = 300 * time.Millisecond // How long to wait for messages the server may or may not send.
+
+// Config is how to reach the server and what to ask it for.
+type Config struct {
+	URL       string            // The server's websocket URL, for example wss://localhost:4002/cm.
+	Dialer    *websocket.Dialer // Used to connect, websocket.DefaultDialer when nil.
+	Operator  Operator          // Does what scenarios need from the server's side. Manual scenarios are skipped when nil.
+	Timeout   time.Duration     // How long the server may take to answer a message, DEFAULT_TIMEOUT when zero.
+	Wait      time.Duration     // How long to wait for the server after the operator acts, DEFAULT_WAIT when zero.
+	Case      string            // A case the server can switch to.
+	OtherCase string            // Another case the server can switch to.
+	FailCase  string            // A case the server fails to switch to, for the post-accept failure.
+	Run       *regexp.Regexp    // Only run the scenarios whose name matches. Optional.
+}
+
+type Status string
+
+const (
+	Passed  Status = "passed"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+)
+
+// Result is how a scenario went.
+type Result struct {
+	Scenario   Scenario
+	Status     Status
+	Failure    string // Why it failed or was skipped.
+	Transcript []string
+	Duration   time.Duration
+}
+
+// Run runs the scenarios one after the other and returns their results in the same order.
+func Run(ctx context.Context, config Config, scenarios []Scenario) []Result {
+	if config.Dialer == nil {
+		config.Dialer = websocket.DefaultDialer
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DEFAULT_TIMEOUT
+	}
+	if config.Wait == 0 {
+		config.Wait = DEFAULT_WAIT
+	}
+
+	results := []Result{}
+	for _, scenario := range scenarios {
+		if config.Run != nil && !config.Run.MatchString(scenario.Name) {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			results = append(results, Result{Scenario: scenario, Status: Skipped, Failure: "Cancelled."})
+			continue
+		}
+
+		if scenario.Manual && config.Operator == nil {
+			results = append(results, Result{Scenario: scenario, Status: Skipped, Failure: "Needs an operator."})
+			continue
+		}
+
+		results = append(results, runScenario(ctx, config, scenario))
+	}
+
+	return results
+}
+
+func runScenario(ctx context.Context, config Config, scenario Scenario) Result {
+	t := &T{ctx: ctx, config: config}
+	start := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer t.closeAll()
+		scenario.Run(t)
+	}()
+	<-done
+
+	result := Result{Scenario: scenario, Status: Passed, Transcript: t.transcript, Duration: time.Since(start)}
+	if t.failure != "" {
+		result.Status = Failed
+		result.Failure = t.failure
+	}
+
+	return result
+}
+
+// T is passed to a scenario to connect to the server and record what happens. Like testing.T, Fatalf ends the scenario
+// and must be called from the scenario's goroutine.
+type T struct {
+	ctx    context.Context
+	config Config
+
+	mu         sync.Mutex
+	transcript []string
+	conns      []*Conn
+	failure    string
+}
+
+// Fatalf fails the scenario and stops it.
+func (t *T) Fatalf(format string, args ...any) {
+	t.mu.Lock()
+	t.failure = fmt.Sprintf(format, args...)
+	t.transcript = append(t.transcript, "FAIL: "+t.failure)
+	t.mu.Unlock()
+	runtime.Goexit()
+}
+
+// Logf adds a note to the transcript.
+func (t *T) Logf(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transcript = append(t.transcript, fmt.Sprintf(format, args...))
+}
+
+// Do asks the operator to act on the server's side.
+func (t *T) Do(action Action) {
+	t.Logf("Operator: %v", action)
+	if err := t.config.Operator.Do(t.ctx, action); err != nil {
+		t.Fatalf("The operator couldn't %v: %v", action, err)
+	}
+}
+
+// Connect opens a websocket to the server. The name labels its messages in the transcript.
+func (t *T) Connect(name string) *Conn {
+	ws, _, err := t.config.Dialer.DialContext(t.ctx, t.config.URL, nil)
+	if err != nil {
+		t.Fatalf("Connecting %v: %v", name, err)
+	}
+	t.Logf("%v connected", name)
+
+	c := &Conn{t: t, name: name, ws: ws, frames: make(chan frame, 100), done: make(chan struct{})}
+	go c.read()
+
+	t.mu.Lock()
+	t.conns = append(t.conns, c)
+	t.mu.Unlock()
+
+	return c
+}
+
+func (t *T) closeAll() {
+	t.mu.Lock()
+	conns := t.conns
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// Conn is a connection to the server.
+type Conn struct {
+	t       *T
+	name    string
+	ws      *websocket.Conn
+	frames  chan frame
+	done    chan struct{} // Closed by Close, so read stops once nobody takes its frames.
+	closed  bool
+	dropped bool // The server closed the connection.
+}
+
+type frame struct {
+	data []byte
+	err  error
+}
+
+func (c *Conn) read() {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		select {
+		case c.frames <- frame{data: data, err: err}:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send sends the message, with a new id if it has none, and returns it as sent.
+func (c *Conn) Send(message model.Message) model.Message {
+	if message.ID == "" {
+		message.ID = util.NewMessageID()
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		c.t.Fatalf("Marshalling %v: %v", message.Kind, err)
+	}
+
+	c.t.Logf("%v → %v\n%v", c.name, message.Kind, pretty(data))
+	if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		c.t.Fatalf("%v sending %v: %v", c.name, message.Kind, err)
+	}
+
+	return message
+}
+
+// SendRaw sends the text as it is, for malformed input.
+func (c *Conn) SendRaw(text string) {
+	c.t.Logf("%v → (raw)\n\t%v", c.name, text)
+	if err := c.ws.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+		c.t.Fatalf("%v sending raw text: %v", c.name, err)
+	}
+}
+
+// Expect waits for the server's next message and fails unless it is one of the kinds.
+func (c *Conn) Expect(kinds ...model.MessageKind) model.Message {
+	return c.expect(c.t.config.Timeout, kinds)
+}
+
+// Await is Expect after the operator acted, it waits as long as the operator may take.
+func (c *Conn) Await(kinds ...model.MessageKind) model.Message {
+	return c.expect(c.t.config.Wait, kinds)
+}
+
+func (c *Conn) expect(timeout time.Duration, kinds []model.MessageKind) model.Message {
+	message, ok := c.next(timeout)
+	if !ok {
+		c.t.Fatalf("%v timed out after %v waiting for %v", c.name, timeout, kindList(kinds))
+	}
+
+	if !slices.Contains(kinds, message.Kind) {
+		c.t.Fatalf("%v expected %v, got %v", c.name, kindList(kinds), message.Kind)
+	}
+
+	return message
+}
+
+// Ask waits for the server's answer to our request. When the server doesn't answer on its own within SETTLE, because
+// it asks its user, the operator is asked to act.
+func (c *Conn) Ask(action Action, kinds ...model.MessageKind) model.Message {
+	message, ok := c.next(SETTLE)
+	if !ok {
+		c.t.Do(action)
+		return c.Await(kinds...)
+	}
+
+	if !slices.Contains(kinds, message.Kind) {
+		c.t.Fatalf("%v expected %v, got %v", c.name, kindList(kinds), message.Kind)
+	}
+
+	return message
+}
+
+// Quiet fails if the server sends anything within SETTLE.
+func (c *Conn) Quiet() {
+	if message, ok := c.next(SETTLE); ok {
+		c.t.Fatalf("%v expected nothing, got %v", c.name, message.Kind)
+	}
+}
+
+// Settle answers a ctx-change-request the server sends within SETTLE by accepting it. Servers may ask a client that
+// just synced to switch to their context.
+func (c *Conn) Settle() {
+	message, ok := c.next(SETTLE)
+	if !ok {
+		return
+	}
+
+	if message.Kind != model.ContextChangeRequest {
+		c.t.Fatalf("%v expected nothing or a %v, got %v", c.name, model.ContextChangeRequest, message.Kind)
+	}
+
+	c.Send(replyTo(util.NewCtxAcceptMessage(message.Context), message))
+}
+
+// next returns the server's next message, it reports false when none arrived within the timeout. The scenario fails
+// when the connection closes or the message isn't valid.
+func (c *Conn) next(timeout time.Duration) (model.Message, bool) {
+	select {
+	case frame := <-c.frames:
+		if frame.err != nil {
+			c.dropped = true
+			c.t.Fatalf("%v was closed by the server: %v", c.name, frame.err)
+		}
+
+		var message model.Message
+		if err := json.Unmarshal(frame.data, &message); err != nil {
+			c.t.Logf("%v ← (raw)\n\t%v", c.name, string(frame.data))
+			c.t.Fatalf("%v received invalid JSON: %v", c.name, err)
+		}
+
+		c.t.Logf("%v ← %v\n%v", c.name, message.Kind, pretty(frame.data))
+		if err := Validate(message); err != nil {
+			c.t.Fatalf("%v received an invalid %v: %v", c.name, message.Kind, err)
+		}
+
+		return message, true
+	case <-time.After(timeout):
+		return model.Message{}, false
+	case <-c.t.ctx.Done():
+		c.t.Fatalf("Cancelled.")
+		return model.Message{}, false
+	}
+}
+
+// Close sends a close frame and waits a moment for the server to close the connection.
+func (c *Conn) Close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	defer close(c.done)
+	if c.dropped {
+		c.ws.Close()
+		return
+	}
+
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case frame := <-c.frames:
+			if frame.err == nil {
+				continue
+			}
+		case <-deadline:
+		}
+
+		c.ws.Close()
+		c.t.Logf("%v closed", c.name)
+		return
+	}
+}
+
+// Validate checks the message has the fields the protocol README requires of a message from the server.
+func Validate(message model.Message) error {
+	if !server.IsKnownMessageKind(message.Kind) {
+		return fmt.Errorf("unknown kind '%v'", message.Kind)
+	}
+
+	for _, item := range append(util.CopyContext(message.Context), message.CurrentContext...) {
+		if item.Key == "" || item.Value == "" {
+			return fmt.Errorf("context item without key or value: %+v", item)
+		}
+	}
+
+	switch message.Kind {
+	case model.SyncRequest:
+		return fmt.Errorf("the server should never send a sync-request")
+	case model.SyncAccept, model.SyncReject:
+		if message.Info == nil || message.Info.Version == 0 || message.Info.Application == "" {
+			return fmt.Errorf("info with version and application is required")
+		}
+	case model.ContextChangeRequest:
+		if len(message.Context) == 0 {
+			return fmt.Errorf("context is required")
+		}
+	case model.QueueUpdate:
+		return fmt.Errorf("queue-update is only sent to clients that list the queue-position capability")
+	}
+
+	switch message.Kind {
+	case model.SyncReject, model.ContextChangeReject:
+		if message.Rejection == nil || message.Rejection.Reason == "" {
+			return fmt.Errorf("rejection with a reason is required")
+		}
+	}
+
+	return nil
+}
+
+func replyTo(message model.Message, request model.Message) model.Message {
+	message.ReplyTo = request.ID
+	return message
+}
+
+func kindList(kinds []model.MessageKind) string {
+	names := []string{}
+	for _, kind := range kinds {
+		names = append(names, string(kind))
+	}
+	return strings.Join(names, " or ")
+}
+
+func pretty(data []byte) string {
+	formatted, err := util.FormatJson(data)
+	if err != nil {
+		return "\t" + string(data)
+	}
+	return formatted
+}
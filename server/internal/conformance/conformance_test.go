@@ -0,0 +1,178 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/contextsync"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/server"
+)
+
+// publicContext converts the scenarios' context for the embedded server.
+func publicContext(context []model.ContextItem) []contextsync.ContextItem {
+	items := []contextsync.ContextItem{}
+	for _, item := range context {
+		items = append(items, contextsync.ContextItem{Key: contextsync.ContextKey(item.Key), Value: item.Value, System: item.System, Type: item.Type, Display: item.Display})
+	}
+	return items
+}
+
+// navigator switches to any case but the ones in fail, like the tcs server's FakeNavigator.
+type navigator struct {
+	fail []string
+
+	mu      sync.Mutex
+	current []contextsync.ContextItem
+}
+
+func (n *navigator) Navigate(context []contextsync.ContextItem) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, item := range context {
+		if item.Key == contextsync.CaseNumber && slices.Contains(n.fail, item.Value) {
+			return fmt.Errorf("%w for case '%v'", server.ErrNavigationFailed, item.Value)
+		}
+	}
+
+	n.current = context
+	return nil
+}
+
+func (n *navigator) Current() ([]contextsync.ContextItem, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.current == nil {
+		return nil, server.ErrNoCurrentContext
+	}
+	return n.current, nil
+}
+
+// serverOperator acts through the embedded server the way a user of the LIS would.
+func serverOperator(cs *contextsync.Server) Operator {
+	return OperatorFunc(func(ctx context.Context, action Action) error {
+		switch action.Kind {
+		case ActionPropose, ActionProposeFail:
+			return cs.ProposeContext(publicContext(action.Context))
+		}
+
+		for deadline := time.Now().Add(DEFAULT_TIMEOUT); !cs.Snapshot().Voting; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("the server never asked about the request")
+			}
+		}
+
+		if action.Kind == ActionAccept {
+			cs.Accept()
+		} else {
+			cs.Reject("The doodad field has not been saved.", contextsync.Conflict)
+		}
+		return nil
+	})
+}
+
+func newConfig(t *testing.T, options ...contextsync.Option) Config {
+	t.Helper()
+	options = append([]contextsync.Option{
+		contextsync.WithInitialContext(publicContext(server.DemoContext("N1"))),
+		contextsync.WithNavigator(&navigator{fail: []string{"N666"}}),
+	}, options...)
+	cs, err := contextsync.New(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(cs)
+	t.Cleanup(func() {
+		httpServer.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		cs.Shutdown(ctx)
+	})
+
+	return Config{
+		URL:       "ws" + strings.TrimPrefix(httpServer.URL, "http") + cs.Path(),
+		Operator:  serverOperator(cs),
+		Wait:      DEFAULT_TIMEOUT,
+		Case:      "N2",
+		OtherCase: "N3",
+		FailCase:  "N666",
+	}
+}
+
+func TestDemoServerConforms(t *testing.T) {
+	results := Run(context.Background(), newConfig(t), Scenarios)
+	if len(results) != len(Scenarios) {
+		t.Fatalf("expected a result per scenario, got %v", len(results))
+	}
+
+	for _, result := range results {
+		if result.Status != Passed {
+			t.Errorf("%v %v: %v\n%v", result.Scenario.Name, result.Status, result.Failure, transcript(result))
+		}
+	}
+}
+
+func TestFailureHasTranscript(t *testing.T) {
+	// With auto accept the server never rejects the client's request.
+	config := newConfig(t, contextsync.WithAutoAccept())
+	config.Run = regexp.MustCompile("^client-change-rejected$")
+	results := Run(context.Background(), config, Scenarios)
+
+	if len(results) != 1 || results[0].Status != Failed {
+		t.Fatalf("expected the scenario to fail, got %+v", results)
+	}
+	if !strings.Contains(results[0].Failure, "expected ctx-change-reject, got ctx-change-accept") {
+		t.Fatalf("expected the failure to say what the server sent, got %v", results[0].Failure)
+	}
+	if log := transcript(results[0]); !strings.Contains(log, `"kind": "ctx-change-accept"`) {
+		t.Fatalf("expected the transcript to have the payloads, got:\n%v", log)
+	}
+}
+
+func TestManualScenariosNeedAnOperator(t *testing.T) {
+	config := newConfig(t)
+	config.Operator = nil
+	results := Run(context.Background(), config, Scenarios)
+
+	for _, result := range results {
+		if result.Scenario.Manual != (result.Status == Skipped) {
+			t.Fatalf("expected only manual scenarios to be skipped, %v was %v", result.Scenario.Name, result.Status)
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []Result{
+		{Scenario: Scenario{Name: "passes"}, Status: Passed, Transcript: []string{"client → sync-request"}, Duration: time.Second},
+		{Scenario: Scenario{Name: "fails"}, Status: Failed, Failure: "Expected <sync-accept>", Duration: time.Second},
+		{Scenario: Scenario{Name: "skips"}, Status: Skipped, Failure: "Needs an operator."},
+	}
+
+	var output bytes.Buffer
+	if err := WriteJUnit(&output, results); err != nil {
+		t.Fatal(err)
+	}
+
+	var suite junitSuite
+	if err := xml.Unmarshal(output.Bytes(), &suite); err != nil {
+		t.Fatalf("expected valid XML, got %v:\n%v", err, output.String())
+	}
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 || suite.Time != "2.000" {
+		t.Fatalf("expected the counts and total time, got %+v", suite)
+	}
+	if suite.Cases[1].Failure == nil || suite.Cases[1].Failure.Message != "Expected <sync-accept>" || suite.Cases[0].SystemOut == nil || suite.Cases[0].SystemOut.Text != "client → sync-request" {
+		t.Fatalf("expected the failure and transcript, got %+v", suite.Cases)
+	}
+}
@@ -0,0 +1,149 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/server"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+type ActionKind string
+
+const (
+	ActionPropose     ActionKind = "propose"      // The server requests Context from the synchronized client.
+	ActionProposeFail ActionKind = "propose-fail" // The server requests Context and then fails to switch to it.
+	ActionAccept      ActionKind = "accept"       // The server's user accepts the client's request for Context.
+	ActionReject      ActionKind = "reject"       // The server's user rejects the client's request for Context.
+)
+
+// Action is something a scenario needs from the server's side, like its user switching case in the LIS.
+type Action struct {
+	Kind    ActionKind
+	Context []model.ContextItem
+}
+
+// String is the instruction for a person at the LIS.
+func (a Action) String() string {
+	context := util.FormatContext(a.Context)
+	switch a.Kind {
+	case ActionPropose:
+		return fmt.Sprintf("switch the LIS to '%v'", context)
+	case ActionProposeFail:
+		return fmt.Sprintf("switch the LIS to '%v', which it must fail to open once the client accepted", context)
+	case ActionAccept:
+		return fmt.Sprintf("accept the client's request for '%v' in the LIS", context)
+	case ActionReject:
+		return fmt.Sprintf("reject the client's request for '%v' in the LIS", context)
+	default:
+		return string(a.Kind)
+	}
+}
+
+// Operator does what scenarios need from the server's side. Do returns once the action was started, the scenario
+// waits for its effect on the connection.
+type Operator interface {
+	Do(ctx context.Context, action Action) error
+}
+
+// OperatorFunc lets any function be used as an Operator.
+type OperatorFunc func(ctx context.Context, action Action) error
+
+func (f OperatorFunc) Do(ctx context.Context, action Action) error {
+	return f(ctx, action)
+}
+
+// PromptOperator asks a person at the LIS to act by writing the instruction to Out.
+type PromptOperator struct {
+	Out io.Writer
+}
+
+func (p PromptOperator) Do(ctx context.Context, action Action) error {
+	_, err := fmt.Fprintf(p.Out, "\033[93mPlease %v.\033[0m\n", action)
+	return err
+}
+
+// ControlOperator drives the demo server through the /control API it serves with -headless -control. The demo server
+// has to run with -fail-cases set to the FailCase of the config for ActionProposeFail.
+type ControlOperator struct {
+	URL    string       // The server's base URL, for example https://localhost:4002.
+	Client *http.Client // Must trust the server's certificate.
+}
+
+func (o ControlOperator) Do(ctx context.Context, action Action) error {
+	switch action.Kind {
+	case ActionPropose, ActionProposeFail:
+		body, err := json.Marshal(action.Context)
+		if err != nil {
+			return err
+		}
+		return o.post(ctx, "/control/context", body)
+	case ActionAccept, ActionReject:
+		// The client's request may still be on its way, the server can only answer it once it asks its user.
+		if err := o.waitForVote(ctx); err != nil {
+			return err
+		}
+		return o.post(ctx, "/control/"+string(action.Kind), nil)
+	default:
+		return fmt.Errorf("unknown action '%v'", action.Kind)
+	}
+}
+
+func (o ControlOperator) waitForVote(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, DEFAULT_TIMEOUT)
+	defer cancel()
+
+	for {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, o.URL+"/control/context", nil)
+		if err != nil {
+			return err
+		}
+
+		response, err := o.Client.Do(request)
+		if err != nil {
+			return err
+		}
+
+		var snapshot server.Snapshot
+		err = json.NewDecoder(response.Body).Decode(&snapshot)
+		response.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading /control/context: %w", err)
+		}
+		if snapshot.Voting {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the server never asked its user about the client's request")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func (o ControlOperator) post(ctx context.Context, path string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	response, err := o.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		message, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("POST %v: %v %s", path, response.Status, bytes.TrimSpace(message))
+	}
+
+	return nil
+}
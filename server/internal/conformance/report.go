@@ -0,0 +1,124 @@
+package conformance
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const SUITE_NAME = "context-sync-conformance"
+
+// AnyFailed reports whether any scenario failed.
+func AnyFailed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteReport writes a line per scenario and the transcript of every failed one, or of every scenario when verbose is
+// set.
+func WriteReport(w io.Writer, results []Result, verbose bool) {
+	counts := map[Status]int{}
+	for _, result := range results {
+		counts[result.Status]++
+
+		switch result.Status {
+		case Passed:
+			fmt.Fprintf(w, "\033[92mPASS\033[0m %v (%.2fs)\n", result.Scenario.Name, result.Duration.Seconds())
+		case Failed:
+			fmt.Fprintf(w, "\033[91mFAIL\033[0m %v (%.2fs): %v\n", result.Scenario.Name, result.Duration.Seconds(), result.Failure)
+		case Skipped:
+			fmt.Fprintf(w, "\033[93mSKIP\033[0m %v: %v\n", result.Scenario.Name, result.Failure)
+		}
+
+		if result.Status == Failed || (verbose && result.Status == Passed) {
+			fmt.Fprintf(w, "%v\n\n", indent(transcript(result)))
+		}
+	}
+
+	fmt.Fprintf(w, "%v passed, %v failed, %v skipped\n", counts[Passed], counts[Failed], counts[Skipped])
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit writes the results as a JUnit XML test suite for CI, with each scenario's transcript as its output.
+func WriteJUnit(w io.Writer, results []Result) error {
+	suite := junitSuite{Name: SUITE_NAME, Tests: len(results)}
+	total := 0.0
+	for _, result := range results {
+		seconds := result.Duration.Seconds()
+		total += seconds
+
+		testCase := junitCase{
+			Name:      result.Scenario.Name,
+			Classname: SUITE_NAME,
+			Time:      fmt.Sprintf("%.3f", seconds),
+		}
+		if len(result.Transcript) > 0 {
+			testCase.SystemOut = &junitOutput{Text: transcript(result)}
+		}
+
+		switch result.Status {
+		case Failed:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: result.Failure, Text: result.Scenario.Description}
+		case Skipped:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: result.Failure}
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func transcript(result Result) string {
+	return strings.Join(result.Transcript, "\n")
+}
+
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}
@@ -0,0 +1,313 @@
+package conformance
+
+import (
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// Scenario is one of the scenarios in the protocol README, scripted from the client's side.
+type Scenario struct {
+	Name        string
+	Description string
+	Manual      bool // Needs the operator to act on the server's side.
+	Run         func(t *T)
+}
+
+// Scenarios are the scenarios in the protocol README in the order it documents them, followed by the messages every
+// server has to answer.
+var Scenarios = []Scenario{
+	{
+		Name:        "sync-without-context",
+		Description: "Client connects to server with no initial context",
+		Run: func(t *T) {
+			c := t.Connect("client")
+			syncConn(t, c, nil)
+			c.Settle()
+		},
+	},
+	{
+		Name:        "sync-with-initial-context",
+		Description: "Client with initial context connects to server, which takes it or asks for its own",
+		Run: func(t *T) {
+			c := t.Connect("client")
+			context := util.ContextFromCaseNumber(t.config.Case)
+			accept := syncConn(t, c, context)
+			if len(accept.Context) > 0 {
+				if !sameCase(accept.Context, context) {
+					t.Fatalf("The sync-accept has '%v', expected the initial context '%v'", util.FormatContext(accept.Context), util.FormatContext(context))
+				}
+				c.Quiet()
+				return
+			}
+
+			t.Logf("The server didn't take the initial context, it has to ask for its own")
+			request := c.Expect(model.ContextChangeRequest)
+			c.Send(replyTo(util.NewCtxAcceptMessage(request.Context), request))
+			c.Quiet()
+		},
+	},
+	{
+		Name:        "server-change-accepted",
+		Description: "Client connects to server and accepts new context",
+		Manual:      true,
+		Run: func(t *T) {
+			c, current := synced(t, "client")
+			request := proposed(t, c, Action{Kind: ActionPropose, Context: otherCase(t, current)})
+			c.Send(replyTo(util.NewCtxAcceptMessage(request.Context), request))
+			c.Quiet()
+
+			if context := currentContext(t, c); !sameCase(context, request.Context) {
+				t.Fatalf("The server is on '%v' after the client accepted '%v'", util.FormatContext(context), util.FormatContext(request.Context))
+			}
+		},
+	},
+	{
+		Name:        "server-change-rejected",
+		Description: "Client connects to server and fails to navigate to new context",
+		Manual:      true,
+		Run: func(t *T) {
+			c, current := synced(t, "client")
+			request := proposed(t, c, Action{Kind: ActionPropose, Context: otherCase(t, current)})
+			c.Send(replyTo(util.NewCtxRejectMessage(current, request.Context, "The client failed to open the case.", model.ServerError), request))
+			c.Quiet()
+			currentContext(t, c)
+		},
+	},
+	{
+		Name:        "sync-reject-while-synchronized",
+		Description: "Client attempts to connect while server has active connection, with a 409 or a 419 and later becomes active",
+		Run: func(t *T) {
+			first := t.Connect("first")
+			syncConn(t, first, nil)
+			first.Settle()
+
+			second := t.Connect("second")
+			request := second.Send(util.NewSubRequestMessage(APPLICATION_NAME, 1, false))
+			reject := second.Expect(model.SyncReject)
+			checkReplyTo(t, reject, request)
+
+			switch reject.Rejection.Status {
+			case model.Conflict:
+				t.Logf("The server doesn't keep waiting clients, the client closes the connection")
+			case model.ConflictWithRetry:
+				t.Logf("The client waits, once the first client leaves the server has to synchronize it")
+				first.Close()
+				second.Expect(model.SyncAccept)
+				second.Settle()
+			default:
+				t.Fatalf("Expected a sync-reject with 409 or 419, got %v", reject.Rejection.Status)
+			}
+		},
+	},
+	{
+		Name:        "client-change-accepted",
+		Description: "Client successfully requests context change",
+		Manual:      true,
+		Run: func(t *T) {
+			c, current := synced(t, "client")
+			context := otherCase(t, current)
+			request := c.Send(util.NewCtxChangeMessage(context))
+			accept := c.Ask(Action{Kind: ActionAccept, Context: context}, model.ContextChangeAccept)
+			checkReplyTo(t, accept, request)
+			if len(accept.Context) > 0 && !sameCase(accept.Context, context) {
+				t.Fatalf("The server accepted '%v', expected '%v'", util.FormatContext(accept.Context), util.FormatContext(context))
+			}
+
+			if current := currentContext(t, c); !sameCase(current, context) {
+				t.Fatalf("The server is on '%v' after accepting '%v'", util.FormatContext(current), util.FormatContext(context))
+			}
+		},
+	},
+	{
+		Name:        "client-change-rejected",
+		Description: "Server rejects context change request",
+		Manual:      true,
+		Run: func(t *T) {
+			c, current := synced(t, "client")
+			context := otherCase(t, current)
+			request := c.Send(util.NewCtxChangeMessage(context))
+			reject := c.Ask(Action{Kind: ActionReject, Context: context}, model.ContextChangeReject)
+			checkReplyTo(t, reject, request)
+			if len(current) > 0 && len(reject.CurrentContext) == 0 {
+				t.Fatalf("The ctx-change-reject has no current_context")
+			}
+
+			if after := currentContext(t, c); !sameCase(after, current) {
+				t.Fatalf("The server is on '%v' after rejecting '%v', expected '%v'", util.FormatContext(after), util.FormatContext(context), util.FormatContext(current))
+			}
+		},
+	},
+	{
+		Name:        "update-to-no-context",
+		Description: "User navigates from case view to worklist view",
+		Run: func(t *T) {
+			c, _ := synced(t, "client")
+			c.Send(util.NewCtxUpdateMessage(nil))
+			c.Quiet()
+			currentContext(t, c)
+		},
+	},
+	{
+		Name:        "post-accept-failure",
+		Description: "Server successfully requests context change and fails to switch",
+		Manual:      true,
+		Run: func(t *T) {
+			c, _ := synced(t, "client")
+			request := proposed(t, c, Action{Kind: ActionProposeFail, Context: util.ContextFromCaseNumber(t.config.FailCase)})
+			c.Send(replyTo(util.NewCtxAcceptMessage(request.Context), request))
+
+			update := c.Expect(model.ContextUpdate)
+			if sameCase(update.Context, request.Context) {
+				t.Fatalf("The server's ctx-update says it switched to '%v'", util.FormatContext(update.Context))
+			}
+			if update.Error != nil {
+				t.Logf("The server reports the error '%v' (%v)", update.Error.Message, update.Error.Status)
+			}
+		},
+	},
+	{
+		Name:        "outstanding-request-collision",
+		Description: "Receive context change request with outstanding context change request",
+		Manual:      true,
+		Run: func(t *T) {
+			c, current := synced(t, "client")
+			theirs := proposed(t, c, Action{Kind: ActionPropose, Context: otherCase(t, current)})
+
+			// Our request crosses theirs, so each side has an outstanding request when the other's arrives.
+			ours := otherCase(t, theirs.Context)
+			request := c.Send(util.NewCtxChangeMessage(ours))
+			c.Send(replyTo(util.NewCtxRejectMessage(current, theirs.Context, "Rejected because of outstanding request.", model.Conflict), theirs))
+
+			answer := c.Ask(Action{Kind: ActionAccept, Context: ours}, model.ContextChangeAccept, model.ContextChangeReject)
+			checkReplyTo(t, answer, request)
+			if answer.Kind == model.ContextChangeReject && answer.Rejection.Status != model.Conflict {
+				t.Fatalf("Expected the server to accept our request or reject it with 409, got %v", answer.Rejection.Status)
+			}
+		},
+	},
+	{
+		Name:        "update-request",
+		Description: "Request the current context",
+		Run: func(t *T) {
+			c, _ := synced(t, "client")
+			currentContext(t, c)
+		},
+	},
+	{
+		Name:        "malformed-input",
+		Description: "Unexpected message received, the server answers with a ctx-update with an error and stays connected",
+		Run: func(t *T) {
+			c, _ := synced(t, "client")
+
+			c.SendRaw("{not json")
+			expectError(t, c, model.Message{})
+
+			expectError(t, c, c.Send(model.Message{Kind: "bogus"}))
+			expectError(t, c, c.Send(model.Message{Kind: model.ContextChangeRequest}))
+			expectError(t, c, c.Send(model.Message{Kind: model.ContextChangeAccept, ReplyTo: "not-a-request", Context: util.ContextFromCaseNumber(t.config.Case)}))
+
+			currentContext(t, c)
+		},
+	},
+	{
+		Name:        "malformed-first-frame",
+		Description: "A client's first message isn't valid JSON, the server answers with a ctx-update with an error and still lets it sync",
+		Run: func(t *T) {
+			c := t.Connect("client")
+
+			c.SendRaw("{not json")
+			expectError(t, c, model.Message{})
+
+			syncConn(t, c, nil)
+			c.Settle()
+		},
+	},
+}
+
+// syncConn sends a sync-request and waits until the server synchronizes the connection. A 419 only means the server
+// hasn't dropped the previous scenario's connection yet, so we wait for the sync-accept.
+func syncConn(t *T, c *Conn, context []model.ContextItem) model.Message {
+	request := util.NewSubRequestMessage(APPLICATION_NAME, 1, false)
+	request.Context = context
+	request = c.Send(request)
+
+	answer := c.Expect(model.SyncAccept, model.SyncReject)
+	checkReplyTo(t, answer, request)
+	if answer.Kind == model.SyncReject {
+		if answer.Rejection.Status != model.ConflictWithRetry {
+			t.Fatalf("The server rejected the sync-request: %v (%v)", answer.Rejection.Reason, answer.Rejection.Status)
+		}
+
+		t.Logf("Another client is still synchronized, waiting to be synchronized")
+		answer = c.Expect(model.SyncAccept)
+	}
+
+	if answer.Info.Version != 1 {
+		t.Fatalf("We only support version 1 but the server chose %v", answer.Info.Version)
+	}
+
+	return answer
+}
+
+// synced connects, syncs without context and returns the connection with the server's current context.
+func synced(t *T, name string) (*Conn, []model.ContextItem) {
+	c := t.Connect(name)
+	syncConn(t, c, nil)
+	c.Settle()
+	return c, currentContext(t, c)
+}
+
+// currentContext asks the server for its context.
+func currentContext(t *T, c *Conn) []model.ContextItem {
+	request := c.Send(model.Message{Kind: model.ContextUpdateRequest})
+	update := c.Expect(model.ContextUpdate)
+	checkReplyTo(t, update, request)
+	if update.Error != nil {
+		t.Fatalf("The server answered the ctx-update-request with the error '%v' (%v)", update.Error.Message, update.Error.Status)
+	}
+
+	return update.Context
+}
+
+// proposed has the operator make the server request the context and returns the server's ctx-change-request.
+func proposed(t *T, c *Conn, action Action) model.Message {
+	t.Do(action)
+	request := c.Await(model.ContextChangeRequest)
+	if !sameCase(request.Context, action.Context) {
+		t.Fatalf("The server requested '%v', expected '%v'", util.FormatContext(request.Context), util.FormatContext(action.Context))
+	}
+
+	return request
+}
+
+// expectError expects the ctx-update with a 400 error the protocol README says answers an unexpected or invalid
+// message. request is the message it answers, empty when it had no id.
+func expectError(t *T, c *Conn, request model.Message) {
+	update := c.Expect(model.ContextUpdate)
+	checkReplyTo(t, update, request)
+	if update.Error == nil || update.Error.Status != model.BadRequest {
+		t.Fatalf("Expected a ctx-update with a 400 error, got %+v", update.Error)
+	}
+}
+
+// checkReplyTo fails when the reply answers another message. Parties don't have to set reply_to.
+func checkReplyTo(t *T, reply, request model.Message) {
+	if reply.ReplyTo != "" && request.ID != "" && reply.ReplyTo != request.ID {
+		t.Fatalf("The %v replies to '%v', expected '%v'", reply.Kind, reply.ReplyTo, request.ID)
+	}
+}
+
+// otherCase returns the context of whichever of the configured cases the context isn't on.
+func otherCase(t *T, context []model.ContextItem) []model.ContextItem {
+	if item, ok := util.ItemForKey(context, model.CaseNumber); ok && item.Value == t.config.Case {
+		return util.ContextFromCaseNumber(t.config.OtherCase)
+	}
+
+	return util.ContextFromCaseNumber(t.config.Case)
+}
+
+func sameCase(a, b []model.ContextItem) bool {
+	aCase, aOK := util.ItemForKey(a, model.CaseNumber)
+	bCase, bOK := util.ItemForKey(b, model.CaseNumber)
+	return aOK && bOK && aCase.Value == bCase.Value
+}
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+const DEFAULT_BUFFER_SIZE = 1024
+
+// Bus fans events out to every subscriber. Publishing never blocks, a subscriber that falls behind misses events
+// instead of holding up the manager.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives events on C until it is closed.
+type Subscription struct {
+	C <-chan model.Event
+
+	bus     *Bus
+	events  chan model.Event
+	dropped atomic.Int64
+
+	// A lossless subscription queues events here for pump instead of sending them to events.
+	lossless bool
+	mu       sync.Mutex
+	queue    []model.Event
+	wake     chan struct{}
+	done     chan struct{} // Closed by Close, so pump stops even when nobody reads C anymore.
+}
+
+// Subscribe returns a subscription that buffers up to size events. A size of zero or less uses DEFAULT_BUFFER_SIZE.
+func (b *Bus) Subscribe(size int) *Subscription {
+	if size <= 0 {
+		size = DEFAULT_BUFFER_SIZE
+	}
+
+	events := make(chan model.Event, size)
+	subscription := &Subscription{
+		C:      events,
+		bus:    b,
+		events: events,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[subscription] = struct{}{}
+
+	return subscription
+}
+
+// SubscribeLossless returns a subscription that never drops events. Publishing still doesn't block, the events queue up
+// without a limit until they are read, so it is for readers that may fall behind for a while but catch up, like
+// callbacks that wait for the user.
+func (b *Bus) SubscribeLossless() *Subscription {
+	events := make(chan model.Event)
+	subscription := &Subscription{
+		C:        events,
+		bus:      b,
+		events:   events,
+		lossless: true,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subscribers[subscription] = struct{}{}
+	b.mu.Unlock()
+
+	go subscription.pump()
+	return subscription
+}
+
+// Publish sends the event to every subscriber. It is safe to call from any goroutine.
+func (b *Bus) Publish(event model.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscription := range b.subscribers {
+		if subscription.lossless {
+			subscription.push(event)
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped.Add(1)
+		}
+	}
+}
+
+// Close stops the subscription. Events already buffered can still be read from C, which is closed after them. A lossless
+// subscription has no buffer, the events it hasn't sent yet are dropped.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subscribers[s]; !ok {
+		return
+	}
+
+	delete(s.bus.subscribers, s)
+	if !s.lossless {
+		close(s.events)
+		return
+	}
+
+	// pump closes events once it stopped.
+	close(s.done)
+}
+
+func (s *Subscription) push(event model.Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *Subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump sends the queued events of a lossless subscription to C in order, until the subscription is closed.
+func (s *Subscription) pump() {
+	defer close(s.events)
+
+	for {
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for i, event := range queue {
+			select {
+			case s.events <- event:
+			case <-s.done:
+				s.drop(len(queue) - i)
+				return
+			}
+		}
+
+		if len(queue) == 0 {
+			select {
+			case <-s.wake:
+			case <-s.done:
+				s.drop(0)
+				return
+			}
+		}
+	}
+}
+
+// drop counts the events pump didn't send, unsent and whatever is still queued, as dropped.
+func (s *Subscription) drop(unsent int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped.Add(int64(unsent + len(s.queue)))
+	s.queue = nil
+}
+
+// Dropped is how many events were dropped because the subscription's buffer was full, or for a lossless subscription
+// because it was closed before they were sent.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func TestPublishFansOut(t *testing.T) {
+	bus := NewBus()
+	first := bus.Subscribe(1)
+	second := bus.Subscribe(1)
+
+	bus.Publish(model.Event{Kind: model.EventInfo, Text: "hello"})
+
+	for _, subscription := range []*Subscription{first, second} {
+		event := <-subscription.C
+		if event.Text != "hello" || event.Time.IsZero() {
+			t.Fatalf("expected a timestamped event, got %+v", event)
+		}
+	}
+}
+
+func TestPublishDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+	subscription := bus.Subscribe(1)
+
+	bus.Publish(model.Event{Kind: model.EventInfo, Text: "kept"})
+	bus.Publish(model.Event{Kind: model.EventInfo, Text: "dropped"})
+
+	if subscription.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped event, got %v", subscription.Dropped())
+	}
+	if event := <-subscription.C; event.Text != "kept" {
+		t.Fatalf("expected the first event to be kept, got %+v", event)
+	}
+}
+
+func TestClose(t *testing.T) {
+	bus := NewBus()
+	subscription := bus.Subscribe(2)
+
+	bus.Publish(model.Event{Kind: model.EventInfo, Text: "buffered"})
+	subscription.Close()
+	subscription.Close()
+	bus.Publish(model.Event{Kind: model.EventInfo, Text: "after close"})
+
+	if event, ok := <-subscription.C; !ok || event.Text != "buffered" {
+		t.Fatalf("expected the buffered event, got %+v", event)
+	}
+	if _, ok := <-subscription.C; ok {
+		t.Fatalf("expected the channel to be closed")
+	}
+}
+
+func TestLosslessKeepsEverything(t *testing.T) {
+	bus := NewBus()
+	subscription := bus.SubscribeLossless()
+
+	for i := range 2 * DEFAULT_BUFFER_SIZE {
+		bus.Publish(model.Event{Kind: model.EventInfo, Text: fmt.Sprint(i)})
+	}
+
+	for count := range 2 * DEFAULT_BUFFER_SIZE {
+		if event := <-subscription.C; event.Text != fmt.Sprint(count) {
+			t.Fatalf("expected event %v, got %+v", count, event)
+		}
+	}
+	subscription.Close()
+
+	if _, ok := <-subscription.C; ok || subscription.Dropped() != 0 {
+		t.Fatalf("expected every event in order and the channel closed, got %v dropped", subscription.Dropped())
+	}
+}
+
+func TestLosslessCloseWithQueuedEvents(t *testing.T) {
+	bus := NewBus()
+	subscription := bus.SubscribeLossless()
+
+	for i := range 10 {
+		bus.Publish(model.Event{Kind: model.EventInfo, Text: fmt.Sprint(i)})
+	}
+	// Nobody reads C, the pump must still stop.
+	subscription.Close()
+
+	closed := make(chan int)
+	go func() {
+		received := 0
+		for range subscription.C {
+			received++
+		}
+		closed <- received
+	}()
+
+	select {
+	case received := <-closed:
+		if received+int(subscription.Dropped()) != 10 {
+			t.Fatalf("expected every event to be sent or dropped, got %v sent and %v dropped", received, subscription.Dropped())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the pump to stop after Close")
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	message := model.Message{Kind: model.ContextChangeRequest, ID: "42"}
+	LogEvent(logger, model.Event{Kind: model.EventMessageReceived, ClientID: "c1", Application: "Fusion", Message: &message})
+	LogEvent(logger, model.Event{Kind: model.EventError, Text: "reading message", Err: errors.New("boom")})
+
+	decoder := json.NewDecoder(&buf)
+	var received, failed map[string]any
+	if err := decoder.Decode(&received); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if received["event"] != "message-received" || received["client_id"] != "c1" || received["message_kind"] != "ctx-change-request" || received["message_id"] != "42" {
+		t.Fatalf("unexpected record %v", received)
+	}
+	if failed["level"] != "ERROR" || failed["error"] != "boom" || failed["msg"] != "reading message" {
+		t.Fatalf("unexpected record %v", failed)
+	}
+}
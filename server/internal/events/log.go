@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// Log writes every event from the subscription to the logger until the subscription is closed.
+func Log(logger *slog.Logger, subscription *Subscription) {
+	for event := range subscription.C {
+		LogEvent(logger, event)
+	}
+}
+
+// LogEvent writes one event as a structured log record. Errors are logged at the error level and everything else at
+// the info level.
+func LogEvent(logger *slog.Logger, event model.Event) {
+	attrs := []slog.Attr{slog.String("event", string(event.Kind))}
+
+	if event.ClientID != "" {
+		attrs = append(attrs, slog.String("client_id", event.ClientID))
+	}
+	if event.Application != "" {
+		attrs = append(attrs, slog.String("application", event.Application))
+	}
+	if event.State != "" {
+		attrs = append(attrs, slog.String("state", string(event.State)))
+	}
+	if len(event.Context) > 0 {
+		attrs = append(attrs, slog.String("context", util.FormatContext(event.Context)))
+	}
+	if event.Message != nil {
+		attrs = append(attrs, slog.String("message_kind", string(event.Message.Kind)))
+		if event.Message.ID != "" {
+			attrs = append(attrs, slog.String("message_id", event.Message.ID))
+		}
+		if payload, err := json.Marshal(event.Message); err == nil {
+			attrs = append(attrs, slog.String("payload", string(payload)))
+		}
+	}
+	if event.Err != nil {
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	}
+
+	level := slog.LevelInfo
+	if event.Kind == model.EventError {
+		level = slog.LevelError
+	}
+
+	text := event.Text
+	if text == "" {
+		text = string(event.Kind)
+	}
+
+	// Build the record ourselves so it carries the time of the event rather than the time it was logged.
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	record := slog.NewRecord(event.Time, level, text, 0)
+	record.AddAttrs(attrs...)
+	logger.Handler().Handle(ctx, record)
+}
@@ -3,10 +3,36 @@ package model
 type Client interface {
 	SendMessage([]byte)
 	Close()
+	CloseWithReason(code int, reason string) // Close with a websocket close code and reason, see RFC 6455 section 7.4.
+	Flushed() <-chan struct{}                // Closed once the messages queued before Close are written.
 
 	ID() string
 	Application() string
 
 	SetTransaction(string)
 	Transaction() string
+
+	SetState(ClientState)
+	State() ClientState
+
+	SetVersion(float64)
+	Version() float64
+}
+
+// ClientState is where a client is in the protocol from the server's point of view.
+type ClientState string
+
+const (
+	ClientConnected          ClientState = "connected"           // The websocket is open but no sync-request has been handled yet.
+	ClientSyncing            ClientState = "syncing"             // A sync-request is being handled.
+	ClientSynced             ClientState = "synced"              // The client is the synchronized client and nothing is outstanding.
+	ClientWaiting            ClientState = "waiting"             // The client was sent a sync-reject 419 and may be synchronized later.
+	ClientOutstandingRequest ClientState = "outstanding-request" // The server sent a ctx-change-request and is waiting for the client to answer it.
+	ClientVoting             ClientState = "voting"              // The client sent a ctx-change-request and the server has to accept or reject it.
+	ClientObserving          ClientState = "observing"           // The client is a read-only observer and is sent every committed context.
+	ClientClosing            ClientState = "closing"             // The server is closing the connection.
+)
+
+func (state ClientState) String() string {
+	return string(state)
 }
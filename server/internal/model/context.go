@@ -4,9 +4,20 @@ type ContextKey string
 
 const (
 	CaseNumber ContextKey = "case"
+	Patient    ContextKey = "patient"  // The patient MRN.
+	Order      ContextKey = "order"    // The order or accession number.
+	Specimen   ContextKey = "specimen" // The specimen id.
+	Block      ContextKey = "block"    // The block id.
+	Slide      ContextKey = "slide"    // The slide id.
+	User       ContextKey = "user"     // The id of the signed in user.
 )
 
+// ContextItem is one key of the context. System, Type and Display are optional and turn the value into a structured
+// identifier, so the same case number from two LIS instances can be told apart.
 type ContextItem struct {
-	Key   ContextKey `json:"key"`
-	Value string     `json:"value"`
+	Key     ContextKey `json:"key"`
+	Value   string     `json:"value"`
+	System  string     `json:"system,omitempty"`  // The system or assigning authority that issued the value.
+	Type    string     `json:"type,omitempty"`    // The kind of identifier, for example "accession" or "MRN".
+	Display string     `json:"display,omitempty"` // A label to show the user instead of the raw value.
 }
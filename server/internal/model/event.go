@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type EventKind string
+
+const (
+	EventClientConnected    EventKind = "client-connected"
+	EventClientDisconnected EventKind = "client-disconnected"
+	EventMessageSent        EventKind = "message-sent"
+	EventMessageReceived    EventKind = "message-received"
+	EventStateChanged       EventKind = "state-changed"
+	EventInfo               EventKind = "info"
+	EventError              EventKind = "error"
+	EventContextChanged     EventKind = "context-changed"  // The current context changed, for whatever reason.
+	EventChangeRequested    EventKind = "change-requested" // A client's context change request waits for the user to vote.
+	EventRuleDecided        EventKind = "rule-decided"     // An accept rule answered a client's context change request.
+)
+
+// Event is something that happened in the manager. Which fields are set depends on the kind.
+type Event struct {
+	Kind        EventKind
+	Time        time.Time
+	ClientID    string        // The client the event is about, if any.
+	Application string        // The application name of that client.
+	Message     *Message      // The message for message-sent and message-received.
+	State       ClientState   // The new state for state-changed.
+	Context     []ContextItem // The context for context-changed, change-requested and rule-decided.
+	Text        string        // A human readable description.
+	Err         error         // The error for error events, if there is one.
+}
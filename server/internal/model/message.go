@@ -11,13 +11,46 @@ const (
 	ContextChangeReject  MessageKind = "ctx-change-reject"
 	ContextUpdateRequest MessageKind = "ctx-update-request"
 	ContextUpdate        MessageKind = "ctx-update"
+	QueueUpdate          MessageKind = "queue-update" // Sent to waiting clients that support CapabilityQueuePosition.
+)
+
+// Capabilities are optional features listed in the sync-request info. The server lists the ones it supports in its
+// sync-accept and sync-reject, a feature is only used when both sides list it.
+const (
+	CapabilityQueuePosition = "queue-position" // The client wants queue-update messages while it is waiting.
 )
 
 type ConnectionInfo struct {
-	Version              float64  `json:"version"`
-	Application          string   `json:"application"`
-	Timeout              *float64 `json:"timeout,omitempty"`
-	ReplaceExitingClient *bool    `json:"replace_exiting_client,omitempty"`
+	Version              float64    `json:"version"`
+	MaxVersion           *float64   `json:"max_version,omitempty"`
+	Application          string     `json:"application"`
+	Timeout              *float64   `json:"timeout,omitempty"`
+	ReplaceExitingClient *bool      `json:"replace_exiting_client,omitempty"`
+	Capabilities         []string   `json:"capabilities,omitempty"`
+	Role                 ClientRole `json:"role,omitempty"`
+}
+
+// ClientRole is what a client asks to be in its sync-request. Without a role the client wants to be the synchronized
+// client.
+type ClientRole string
+
+const (
+	RoleObserver ClientRole = "observer" // Follows the committed context through ctx-update messages but never changes it.
+)
+
+// QueueStatus is the server's estimate of when a waiting client will be synchronized.
+type QueueStatus string
+
+const (
+	QueueNext   QueueStatus = "next"   // The client is synchronized when the synchronized client leaves.
+	QueueQueued QueueStatus = "queued" // Other clients are ahead of this one.
+	QueueHeld   QueueStatus = "held"   // The server won't synchronize this client on its own, only a user can promote it.
+)
+
+type QueueInfo struct {
+	Position int         `json:"position"` // Starts at 1.
+	Size     int         `json:"size"`     // How many clients are waiting.
+	Status   QueueStatus `json:"status"`
 }
 
 type MessageRejection struct {
@@ -32,9 +65,12 @@ type MessageError struct {
 
 type Message struct {
 	Kind           MessageKind       `json:"kind"`
+	ID             string            `json:"id,omitempty"`
+	ReplyTo        string            `json:"reply_to,omitempty"`
 	Info           *ConnectionInfo   `json:"info,omitempty"`
 	Context        []ContextItem     `json:"context,omitempty"`
 	CurrentContext []ContextItem     `json:"current_context,omitempty"`
 	Rejection      *MessageRejection `json:"rejection,omitempty"`
 	Error          *MessageError     `json:"error,omitempty"`
+	Queue          *QueueInfo        `json:"queue,omitempty"`
 }
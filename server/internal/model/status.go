@@ -9,6 +9,7 @@ const (
 	RequestTimeout    StatusCode = 408
 	Conflict          StatusCode = 409
 	ConflictWithRetry StatusCode = 419
+	UpgradeRequired   StatusCode = 426
 	TooManyRequests   StatusCode = 429
 	ServerError       StatusCode = 500
 )
@@ -27,6 +28,8 @@ func (ack StatusCode) String() string {
 		return "Conflict"
 	case ConflictWithRetry:
 		return "ConflictWithRetry"
+	case UpgradeRequired:
+		return "UpgradeRequired"
 	case TooManyRequests:
 		return "TooManyRequests"
 	case ServerError:
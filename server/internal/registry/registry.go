@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+// identifierPattern is what the built in keys accept, an id that starts with a letter or digit and has no whitespace.
+const identifierPattern = `^[A-Za-z0-9][A-Za-z0-9._:/-]*$`
+
+const defaultMaxLength = 64
+
+// KeySpec describes one context key and how its value is validated.
+type KeySpec struct {
+	Key       model.ContextKey `json:"key"`
+	Required  bool             `json:"required,omitempty"`   // The key must be in every non-empty context.
+	Pattern   string           `json:"pattern,omitempty"`    // A regular expression the value must match.
+	MinLength int              `json:"min_length,omitempty"` // The minimum value length, zero means at least one character.
+	MaxLength int              `json:"max_length,omitempty"` // The maximum value length, zero means no limit.
+
+	pattern *regexp.Regexp
+}
+
+// Registry holds the context keys we know about. A key may only appear once in a context.
+type Registry struct {
+	Strict bool // If true context with keys that aren't registered is invalid.
+
+	specs map[model.ContextKey]KeySpec
+	order []model.ContextKey
+}
+
+func New() *Registry {
+	return &Registry{
+		specs: make(map[model.ContextKey]KeySpec),
+	}
+}
+
+// Default returns a registry with the keys Fusion and the LIS exchange. Only the case is required.
+func Default() *Registry {
+	registry := New()
+	for _, key := range []model.ContextKey{model.CaseNumber, model.Patient, model.Order, model.Specimen, model.Block, model.Slide, model.User} {
+		spec := KeySpec{
+			Key:       key,
+			Required:  key == model.CaseNumber,
+			Pattern:   identifierPattern,
+			MaxLength: defaultMaxLength,
+		}
+
+		// The built in specs are known to be valid.
+		if err := registry.register(spec); err != nil {
+			panic(err)
+		}
+	}
+
+	return registry
+}
+
+// Register adds a key or changes the spec of a key that is already registered. Fields the new spec leaves at their zero
+// value keep what the key had, so changing the length of a built in key keeps its pattern and required flag.
+func (r *Registry) Register(spec KeySpec) error {
+	if existing, ok := r.specs[spec.Key]; ok {
+		spec.Required = spec.Required || existing.Required
+		if spec.Pattern == "" {
+			spec.Pattern = existing.Pattern
+		}
+		if spec.MinLength == 0 {
+			spec.MinLength = existing.MinLength
+		}
+		if spec.MaxLength == 0 {
+			spec.MaxLength = existing.MaxLength
+		}
+	}
+
+	return r.register(spec)
+}
+
+// register adds a key or replaces the spec of a key that is already registered.
+func (r *Registry) register(spec KeySpec) error {
+	if spec.Key == "" {
+		return fmt.Errorf("context key spec has no key")
+	}
+
+	spec.pattern = nil
+	if spec.Pattern != "" {
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for context key '%v': %w", spec.Key, err)
+		}
+		spec.pattern = pattern
+	}
+
+	if spec.MaxLength > 0 && spec.MinLength > spec.MaxLength {
+		return fmt.Errorf("min_length %v is greater than max_length %v for context key '%v'", spec.MinLength, spec.MaxLength, spec.Key)
+	}
+
+	if _, ok := r.specs[spec.Key]; !ok {
+		r.order = append(r.order, spec.Key)
+	}
+	r.specs[spec.Key] = spec
+
+	return nil
+}
+
+// RegisterFile registers every spec in a JSON file holding an array of key specs. A spec for a key that is already
+// registered only changes the fields it has, "required": false makes a built in key optional.
+func (r *Registry) RegisterFile(path string) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading context keys: %w", err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(bytes, &raw); err != nil {
+		return fmt.Errorf("parsing context keys in %v: %w", path, err)
+	}
+
+	for _, item := range raw {
+		var key struct {
+			Key model.ContextKey `json:"key"`
+		}
+		if err := json.Unmarshal(item, &key); err != nil {
+			return fmt.Errorf("parsing context keys in %v: %w", path, err)
+		}
+
+		// Decoding over the existing spec keeps the fields the file leaves out.
+		spec := r.specs[key.Key]
+		if err := json.Unmarshal(item, &spec); err != nil {
+			return fmt.Errorf("parsing context keys in %v: %w", path, err)
+		}
+		if err := r.register(spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) Lookup(key model.ContextKey) (KeySpec, bool) {
+	spec, ok := r.specs[key]
+	return spec, ok
+}
+
+// Keys returns the registered keys in the order they were registered.
+func (r *Registry) Keys() []model.ContextKey {
+	return append([]model.ContextKey{}, r.order...)
+}
+
+// Validate checks every item in the context against its spec. The error says exactly which key or value is wrong so it
+// can be sent back to the other party as the rejection reason. An empty context is valid, it means no context.
+func (r *Registry) Validate(context []model.ContextItem) error {
+	if len(context) == 0 {
+		return nil
+	}
+
+	seen := make(map[model.ContextKey]bool, len(context))
+	for _, item := range context {
+		if item.Key == "" {
+			return fmt.Errorf("context item has no key")
+		}
+
+		if seen[item.Key] {
+			return fmt.Errorf("context key '%v' appears more than once", item.Key)
+		}
+		seen[item.Key] = true
+
+		spec, ok := r.specs[item.Key]
+		if !ok {
+			if r.Strict {
+				return fmt.Errorf("unknown context key '%v'", item.Key)
+			}
+			continue
+		}
+
+		if err := spec.validate(item.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range r.order {
+		if r.specs[key].Required && !seen[key] {
+			return fmt.Errorf("context key '%v' is required", key)
+		}
+	}
+
+	return nil
+}
+
+func (spec KeySpec) validate(value string) error {
+	minLength := max(spec.MinLength, 1)
+	if len(value) < minLength {
+		if minLength == 1 {
+			return fmt.Errorf("context key '%v' has no value", spec.Key)
+		}
+		return fmt.Errorf("value for context key '%v' must be at least %v characters", spec.Key, minLength)
+	}
+
+	if spec.MaxLength > 0 && len(value) > spec.MaxLength {
+		return fmt.Errorf("value for context key '%v' must be at most %v characters", spec.Key, spec.MaxLength)
+	}
+
+	if spec.pattern != nil && !spec.pattern.MatchString(value) {
+		return fmt.Errorf("value '%v' for context key '%v' does not match %v", value, spec.Key, spec.Pattern)
+	}
+
+	return nil
+}
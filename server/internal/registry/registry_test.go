@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func TestValidate(t *testing.T) {
+	registry := Default()
+
+	tests := []struct {
+		name    string
+		context []model.ContextItem
+		err     string
+	}{
+		{"empty", nil, ""},
+		{"case only", []model.ContextItem{{Key: model.CaseNumber, Value: "N123456"}}, ""},
+		{"unknown key", []model.ContextItem{{Key: model.CaseNumber, Value: "N1"}, {Key: "foo", Value: "bar"}}, ""},
+		{"missing case", []model.ContextItem{{Key: model.Patient, Value: "p-1"}}, "context key 'case' is required"},
+		{"duplicate", []model.ContextItem{{Key: model.CaseNumber, Value: "N1"}, {Key: model.CaseNumber, Value: "N2"}}, "appears more than once"},
+		{"empty value", []model.ContextItem{{Key: model.CaseNumber, Value: ""}}, "has no value"},
+		{"pattern", []model.ContextItem{{Key: model.CaseNumber, Value: "N 1"}}, "does not match"},
+		{"too long", []model.ContextItem{{Key: model.CaseNumber, Value: strings.Repeat("N", 65)}}, "at most 64 characters"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := registry.Validate(test.context)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("expected valid context, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestStrictRejectsUnknownKeys(t *testing.T) {
+	registry := Default()
+	registry.Strict = true
+
+	err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N1"}, {Key: "foo", Value: "bar"}})
+	if err == nil || !strings.Contains(err.Error(), "unknown context key 'foo'") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestRegisterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	specs := `[{"key": "stain", "required": true, "pattern": "^(HE|IHC)$"}, {"key": "case", "max_length": 8}]`
+	if err := os.WriteFile(path, []byte(specs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := Default()
+	if err := registry.RegisterFile(path); err != nil {
+		t.Fatalf("RegisterFile: %v", err)
+	}
+
+	if err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N1"}, {Key: "stain", Value: "HE"}}); err != nil {
+		t.Fatalf("expected valid context, got %v", err)
+	}
+	if err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N1"}}); err == nil {
+		t.Fatalf("expected the custom key to be required")
+	}
+	if err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N12345678"}, {Key: "stain", Value: "HE"}}); err == nil {
+		t.Fatalf("expected the changed case spec to limit the length")
+	}
+}
+
+func TestRegisterKeepsUnsetFields(t *testing.T) {
+	registry := Default()
+	if err := registry.Register(KeySpec{Key: model.CaseNumber, MaxLength: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Validate([]model.ContextItem{{Key: model.Patient, Value: "p-1"}}); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Fatalf("expected case to stay required, got %v", err)
+	}
+	if err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N 1"}}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected case to keep its pattern, got %v", err)
+	}
+	if err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N12345678"}}); err == nil {
+		t.Fatalf("expected the new max_length to apply")
+	}
+}
+
+func TestRegisterFileMakesKeyOptional(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`[{"key": "case", "required": false}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := Default()
+	if err := registry.RegisterFile(path); err != nil {
+		t.Fatalf("RegisterFile: %v", err)
+	}
+
+	if err := registry.Validate([]model.ContextItem{{Key: model.Patient, Value: "p-1"}}); err != nil {
+		t.Fatalf("expected case to be optional, got %v", err)
+	}
+	if err := registry.Validate([]model.ContextItem{{Key: model.CaseNumber, Value: "N 1"}}); err == nil {
+		t.Fatalf("expected case to keep its pattern")
+	}
+}
+
+func TestRegisterInvalidPattern(t *testing.T) {
+	if err := New().Register(KeySpec{Key: "bad", Pattern: "("}); err == nil {
+		t.Fatalf("expected an invalid pattern to be rejected")
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+const OUTSTANDING_REQUEST_REASON = "Rejected because of outstanding request."
+
+// CollisionPolicy decides how the server answers a client's context change request that crosses a context change
+// request the server already sent. See the last sequence diagram in the README.
+type CollisionPolicy string
+
+const (
+	CollisionAsk    CollisionPolicy = "ask"    // Let the user accept or reject the client's request in the TUI.
+	CollisionYield  CollisionPolicy = "yield"  // Accept the client's request. The client rejects ours with a 409.
+	CollisionReject CollisionPolicy = "reject" // Reject the client's request with a 409. Both sides end up out of sync.
+)
+
+func ParseCollisionPolicy(policy string) (CollisionPolicy, error) {
+	switch CollisionPolicy(policy) {
+	case CollisionAsk, CollisionYield, CollisionReject:
+		return CollisionPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("unknown collision policy '%v', expected one of %v, %v or %v", policy, CollisionAsk, CollisionYield, CollisionReject)
+}
+
+// handleCollision is called when the client's context change request arrives while our own request is outstanding.
+// The client's request is already recorded as the vote.
+func (m *Manager) handleCollision() {
+	m.collision = true
+	m.Printf("Collision, the client requested '%v' while our request for '%v' is outstanding", util.FormatContext(m.voteContext), util.FormatContext(m.outstandingContext))
+
+	// Both sides asked for the same context so there is nothing to decide.
+	if util.ContextEqual(m.voteContext, m.outstandingContext) {
+		m.accept()
+		return
+	}
+
+	switch m.CollisionPolicy {
+	case CollisionYield:
+		m.accept()
+	case CollisionReject:
+		m.reject()
+	default:
+		m.answerVote()
+	}
+}
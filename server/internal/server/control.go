@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+// ControlHandler lets local tools drive the manager over HTTP when it runs headless:
+//
+//	GET  /control/context  returns the manager state.
+//	POST /control/context  requests the context in the body, a JSON array of context items.
+//	POST /control/accept   accepts the client's context change request.
+//	POST /control/reject   rejects the client's context change request.
+//	POST /control/promote  promotes the waiting client in the client_id query parameter, or the one the policy picks.
+//
+// Only requests from the loopback interface without an Origin header are allowed, so a web page can't drive it.
+func ControlHandler(manager *Manager) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /control/context", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manager.Snapshot())
+	})
+
+	mux.HandleFunc("POST /control/context", func(w http.ResponseWriter, r *http.Request) {
+		var context []model.ContextItem
+		if err := json.NewDecoder(r.Body).Decode(&context); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.Keys.Validate(context); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := manager.ContextChangeRequest(context); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	mux.HandleFunc("POST /control/accept", func(w http.ResponseWriter, r *http.Request) {
+		manager.Accept()
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	mux.HandleFunc("POST /control/reject", func(w http.ResponseWriter, r *http.Request) {
+		manager.Reject()
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	mux.HandleFunc("POST /control/promote", func(w http.ResponseWriter, r *http.Request) {
+		manager.Promote(r.URL.Query().Get("client_id"))
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" || !isLoopback(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
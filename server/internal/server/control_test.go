@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestControlHandler(t *testing.T) {
+	m := newTestManager(t)
+	handler := ControlHandler(m)
+
+	request := httptest.NewRequest(http.MethodPost, "/control/context", strings.NewReader(`[{"key": "case", "value": "N2"}]`))
+	request.RemoteAddr = "127.0.0.1:5000"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusAccepted || m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected the context to change, got %v %v", recorder.Code, m.Snapshot().CurrentCase())
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/control/context", strings.NewReader(`[{"key": "patient", "value": "p-1"}]`))
+	request.RemoteAddr = "127.0.0.1:5000"
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid context to be rejected, got %v", recorder.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/control/context", nil)
+	request.RemoteAddr = "127.0.0.1:5000"
+	request.Header.Set("Origin", "https://example.com")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected requests from web pages to be forbidden, got %v", recorder.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/control/context", nil)
+	request.RemoteAddr = "192.168.1.10:5000"
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected remote requests to be forbidden, got %v", recorder.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// ContextChange is a context change the guards are asked about.
+type ContextChange struct {
+	From        []model.ContextItem // The current context.
+	To          []model.ContextItem // The context we would switch to.
+	Application string              // The application that asked for the change, empty when the user of this server did.
+}
+
+// ContextChangeGuard can veto a context change, for example because the user has an unsaved report open. The guards run
+// before we accept a client's change, including the initial context in a sync-request, and before we send a change of
+// our own. They are called on the manager goroutine so they should return quickly.
+type ContextChangeGuard interface {
+	// Check returns nil to allow the change, or the reason and status sent in the ctx-change-reject.
+	Check(change ContextChange) *model.MessageRejection
+}
+
+// GuardFunc lets a plain function be used as a ContextChangeGuard.
+type GuardFunc func(change ContextChange) *model.MessageRejection
+
+func (f GuardFunc) Check(change ContextChange) *model.MessageRejection {
+	return f(change)
+}
+
+// VetoError is returned when a guard vetoes a change of our own.
+type VetoError struct {
+	Rejection model.MessageRejection
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("context change vetoed: %v", e.Rejection.Reason)
+}
+
+// guard runs the guards in order and returns the first veto, or nil when they all allow the change. A veto without a
+// status is sent as a 409.
+func (m *Manager) guard(application string, context []model.ContextItem) *model.MessageRejection {
+	change := ContextChange{From: util.CopyContext(m.context), To: util.CopyContext(context), Application: application}
+	for _, guard := range m.Guards {
+		rejection := guard.Check(change)
+		if rejection == nil {
+			continue
+		}
+
+		// Guards may return a shared rejection, so the default status goes on a copy.
+		veto := *rejection
+		if veto.Status == 0 {
+			veto.Status = model.Conflict
+		}
+		m.PrintErrString("Context change to '%v' vetoed: %v", util.FormatContext(context), veto.Reason)
+		return &veto
+	}
+
+	return nil
+}
+
+// applicationOf is the application of the client, or empty for LOCAL_PARTICIPANT and clients that left.
+func (m *Manager) applicationOf(clientID string) string {
+	if client := m.clients[clientID]; client != nil {
+		return client.Application()
+	}
+
+	return ""
+}
+
+// UnsavedGuard vetoes every change while a field has unsaved edits, so the user doesn't lose them.
+type UnsavedGuard struct {
+	mu     sync.Mutex
+	fields []string
+}
+
+func NewUnsavedGuard(fields ...string) *UnsavedGuard {
+	return &UnsavedGuard{fields: fields}
+}
+
+// Edit marks the field as having unsaved edits.
+func (g *UnsavedGuard) Edit(field string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !slices.Contains(g.fields, field) {
+		g.fields = append(g.fields, field)
+	}
+}
+
+// Save marks the field as saved.
+func (g *UnsavedGuard) Save(field string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fields = slices.DeleteFunc(g.fields, func(f string) bool { return f == field })
+}
+
+func (g *UnsavedGuard) Check(change ContextChange) *model.MessageRejection {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.fields) == 0 {
+		return nil
+	}
+
+	return &model.MessageRejection{Reason: fmt.Sprintf("The %v field has not been saved.", g.fields[0]), Status: model.Conflict}
+}
+
+// CaseLockGuard vetoes switching to a case another user has locked, for example while they sign it out.
+type CaseLockGuard struct {
+	Locks map[string]string // The user holding the lock, by case number.
+}
+
+func (g CaseLockGuard) Check(change ContextChange) *model.MessageRejection {
+	caseNumber := CaseNumberFromContext(change.To)
+	user, ok := g.Locks[caseNumber]
+	if !ok {
+		return nil
+	}
+
+	return &model.MessageRejection{Reason: fmt.Sprintf("Case %v is locked by %v.", caseNumber, user), Status: model.Conflict}
+}
+
+// PatientMismatchGuard vetoes a context whose patient isn't the patient the case belongs to, which would show one
+// patient's slides next to another patient's report.
+type PatientMismatchGuard struct {
+	Patients map[string]string // The patient id, by case number.
+}
+
+func (g PatientMismatchGuard) Check(change ContextChange) *model.MessageRejection {
+	caseNumber := CaseNumberFromContext(change.To)
+	expected, ok := g.Patients[caseNumber]
+	if !ok {
+		return nil
+	}
+
+	patient, ok := util.ItemForKey(change.To, model.Patient)
+	if !ok || patient.Value == expected {
+		return nil
+	}
+
+	return &model.MessageRejection{Reason: fmt.Sprintf("Case %v belongs to patient %v, not %v.", caseNumber, expected, patient.Value), Status: model.BadRequest}
+}
+
+// ParseCaseValues parses the -locked-cases and -case-patients flags, comma separated CASE=value pairs.
+func ParseCaseValues(pairs string) (map[string]string, error) {
+	values := make(map[string]string)
+	if pairs == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(pairs, ",") {
+		caseNumber, value, ok := strings.Cut(pair, "=")
+		if !ok || caseNumber == "" || value == "" {
+			return nil, fmt.Errorf("invalid pair '%v', expected CASE=value", pair)
+		}
+		values[caseNumber] = value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func TestGuards(t *testing.T) {
+	unsaved := NewUnsavedGuard("doodad")
+	locks := CaseLockGuard{Locks: map[string]string{"N2": "alice"}}
+	patients := PatientMismatchGuard{Patients: map[string]string{"N3": "p-3"}}
+
+	if rejection := unsaved.Check(ContextChange{To: caseContext("N1")}); rejection == nil || rejection.Reason != "The doodad field has not been saved." {
+		t.Fatalf("expected the unsaved doodad field to veto, got %+v", rejection)
+	}
+	unsaved.Save("doodad")
+	if rejection := unsaved.Check(ContextChange{To: caseContext("N1")}); rejection != nil {
+		t.Fatalf("expected no veto once saved, got %+v", rejection)
+	}
+
+	if rejection := locks.Check(ContextChange{To: caseContext("N2")}); rejection == nil || rejection.Status != model.Conflict {
+		t.Fatalf("expected the locked case to veto with a 409, got %+v", rejection)
+	}
+	if rejection := locks.Check(ContextChange{To: caseContext("N1")}); rejection != nil {
+		t.Fatalf("expected an unlocked case to be allowed, got %+v", rejection)
+	}
+
+	mismatch := []model.ContextItem{{Key: model.Patient, Value: "p-4"}, {Key: model.CaseNumber, Value: "N3"}}
+	if rejection := patients.Check(ContextChange{To: mismatch}); rejection == nil || rejection.Status != model.BadRequest {
+		t.Fatalf("expected the patient mismatch to veto with a 400, got %+v", rejection)
+	}
+	match := []model.ContextItem{{Key: model.Patient, Value: "p-3"}, {Key: model.CaseNumber, Value: "N3"}}
+	if rejection := patients.Check(ContextChange{To: match}); rejection != nil {
+		t.Fatalf("expected the matching patient to be allowed, got %+v", rejection)
+	}
+
+	if values, err := ParseCaseValues("N1=alice,N2=bob"); err != nil || values["N2"] != "bob" {
+		t.Fatalf("expected the pairs to parse, got %v %v", values, err)
+	}
+	if _, err := ParseCaseValues("N1"); err == nil {
+		t.Fatalf("expected a pair without a value to be rejected")
+	}
+}
+
+func TestGuardVetoesClientRequest(t *testing.T) {
+	m := newTestManager(t)
+	m.AutoAccept = true
+	var asked ContextChange
+	m.Guards = []ContextChangeGuard{
+		GuardFunc(func(change ContextChange) *model.MessageRejection {
+			asked = change
+			return nil
+		}),
+		NewUnsavedGuard("doodad"),
+	}
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+
+	reject := client.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.ReplyTo != "request-1" || reject.Rejection.Reason != "The doodad field has not been saved." || reject.Rejection.Status != model.Conflict {
+		t.Fatalf("expected the guard's ctx-change-reject, got %+v", reject)
+	}
+	if asked.Application != "Fusion" || CaseNumberFromContext(asked.From) != "N123456" || CaseNumberFromContext(asked.To) != "N2" {
+		t.Fatalf("expected the guards to be told about the change, got %+v", asked)
+	}
+	if client.State() != model.ClientSynced || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected to stay synced on N123456, got %v on %v", client.State(), m.Snapshot().CurrentCase())
+	}
+}
+
+func TestGuardVetoesOurRequest(t *testing.T) {
+	m := newTestManager(t)
+	m.Guards = []ContextChangeGuard{CaseLockGuard{Locks: map[string]string{"N2": "alice"}}}
+	client := connect(t, m, "first")
+	sent := len(client.sent)
+
+	m.ContextChangeRequest(caseContext("N2"))
+	if len(client.sent) != sent || m.Snapshot().Outstanding {
+		t.Fatalf("expected the vetoed request not to be sent, got %+v", client.sent[sent:])
+	}
+
+	m.ContextChangeRequest(caseContext("N3"))
+	if request := client.last(t); request.Kind != model.ContextChangeRequest || CaseNumberFromContext(request.Context) != "N3" {
+		t.Fatalf("expected an allowed request to be sent, got %+v", request)
+	}
+}
+
+func TestGuardRejectionIsNotChanged(t *testing.T) {
+	shared := &model.MessageRejection{Reason: "Locked."}
+	m := newTestManager(t)
+	m.AutoAccept = true
+	m.Guards = []ContextChangeGuard{GuardFunc(func(change ContextChange) *model.MessageRejection {
+		return shared
+	})}
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+	if reject := client.last(t); reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.Conflict {
+		t.Fatalf("expected a 409 ctx-change-reject, got %+v", reject)
+	}
+	if shared.Status != 0 {
+		t.Fatalf("expected the guard's rejection to be left alone, got %+v", shared)
+	}
+}
+
+func TestGuardVetoesInitialContext(t *testing.T) {
+	m := newTestManager(t)
+	m.Guards = []ContextChangeGuard{CaseLockGuard{Locks: map[string]string{"N2": "alice"}}}
+	client := newFakeClient("first")
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1}, Context: caseContext("N2")})
+
+	if len(client.sent) != 2 || len(client.sent[0].Context) != 0 || client.sent[1].Kind != model.ContextChangeRequest {
+		t.Fatalf("expected a sync-accept without context and a ctx-change-request for ours, got %+v", client.sent)
+	}
+	if m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected to stay on N123456, got %v", m.Snapshot().CurrentCase())
+	}
+}
+
+func TestGuardVetoesHubVote(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	m.Guards = []ContextChangeGuard{NewUnsavedGuard("report")}
+	fusion, lis := participants[0], participants[1]
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+	answer(t, m, lis, model.ContextChangeAccept, nil)
+	m.Accept()
+
+	reject := fusion.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Reason != "The report field has not been saved." {
+		t.Fatalf("expected the change to be rolled back with the guard's reason, got %+v", reject)
+	}
+}
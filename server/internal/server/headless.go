@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/Techcyte/context-sync/server/internal/certs"
+	"github.com/Techcyte/context-sync/server/internal/events"
+)
+
+// Headless runs the manager and the TLS listener without a terminal, for running as a background service or in CI.
+type Headless struct {
+	Manager *Manager
+	Handler http.Handler // The handler to serve, nil uses http.DefaultServeMux.
+	Logger  *slog.Logger // Every event the manager publishes is logged here.
+	Input   io.Reader    // Optional. Commands are read from it one per line, see RunCommand.
+}
+
+// Run serves until ctx is cancelled, the listener fails or a "quit" command is read.
+func (h Headless) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srv := &http.Server{Addr: h.Manager.Address, Handler: h.Handler}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- srv.ListenAndServeTLS(certs.ServerCertFile, certs.ServerKeyFile)
+	}()
+
+	subscription := h.Manager.Events.Subscribe(0)
+	loggerDone := make(chan struct{})
+	go func() {
+		defer close(loggerDone)
+		events.Log(h.Logger, subscription)
+	}()
+
+	if h.Input != nil {
+		go h.readCommands(ctx, cancel)
+	}
+
+	h.Manager.Printf("Context sync manager is running at %v", h.Manager.Address)
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-listenErr:
+	}
+
+	h.Manager.Println("Shutting down")
+	if shutdownErr := Shutdown(srv, h.Manager); err == nil {
+		err = shutdownErr
+	}
+
+	subscription.Close()
+	<-loggerDone
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (h Headless) readCommands(ctx context.Context, quit context.CancelFunc) {
+	scanner := bufio.NewScanner(h.Input)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if !h.Manager.RunCommand(scanner.Text()) {
+			quit()
+			return
+		}
+	}
+}
+
+// RunCommand runs one line of non-interactive input. "accept" and "reject" vote on the client's context change
+// request, "promote [client id]" synchronizes a waiting client, "quit" stops, anything else is context to request in
+// the same format as the TUI input. It returns false when the caller should stop.
+func (m *Manager) RunCommand(line string) bool {
+	line = strings.TrimSpace(line)
+
+	switch line {
+	case "":
+	case "a", "accept":
+		m.Accept()
+	case "r", "reject":
+		m.Reject()
+	case "p", "promote":
+		m.Promote("")
+	case "q", "quit":
+		return false
+	default:
+		if clientID, ok := strings.CutPrefix(line, "promote "); ok {
+			m.Promote(strings.TrimSpace(clientID))
+			break
+		}
+
+		context, err := m.ContextFromInput(line, m.Snapshot().Context)
+		if err != nil {
+			m.PrintErr(err, "error invalid context")
+			break
+		}
+
+		m.ContextChangeRequest(context)
+	}
+
+	return true
+}
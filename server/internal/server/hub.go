@@ -0,0 +1,364 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// In hub mode every client that syncs is a participant, for example Fusion, the LIS and a slide viewer that all need to
+// show the same case, and the user of this server is a participant too. A context change proposed by any participant
+// is sent to all the others and only committed once enough of them accept it.
+
+// QuorumRule decides how many of the other participants have to accept a change in hub mode.
+type QuorumRule string
+
+const (
+	QuorumAll      QuorumRule = "all"      // Every other participant has to accept, any rejection rolls the change back.
+	QuorumMajority QuorumRule = "majority" // More than half of the other participants have to accept.
+	QuorumAny      QuorumRule = "any"      // One acceptance is enough.
+)
+
+func ParseQuorumRule(rule string) (QuorumRule, error) {
+	switch QuorumRule(rule) {
+	case QuorumAll, QuorumMajority, QuorumAny:
+		return QuorumRule(rule), nil
+	}
+
+	return "", fmt.Errorf("unknown quorum rule '%v', expected one of %v, %v or %v", rule, QuorumAll, QuorumMajority, QuorumAny)
+}
+
+// required is how many of the voters have to accept for the change to commit.
+func (rule QuorumRule) required(voters int) int {
+	switch rule {
+	case QuorumMajority:
+		return min(voters/2+1, voters)
+	case QuorumAny:
+		return min(1, voters)
+	default:
+		return voters
+	}
+}
+
+const LOCAL_PARTICIPANT = "" // The voter id of the user of this server.
+
+type vote int
+
+const (
+	votePending vote = iota
+	voteAccepted
+	voteRejected
+)
+
+// negotiation is a context change in hub mode that the participants are voting on.
+type negotiation struct {
+	originator string              // The client id of the participant that proposed the change, or LOCAL_PARTICIPANT.
+	requestID  string              // The id of the originator's ctx-change-request, echoed in our answer.
+	context    []model.ContextItem // The proposed context.
+	votes      map[string]vote     // Every other participant's vote by client id.
+	rejection  *model.MessageRejection
+	timer      *time.Timer
+}
+
+func (n *negotiation) count() (accepted, rejected, pending int) {
+	for _, vote := range n.votes {
+		switch vote {
+		case voteAccepted:
+			accepted++
+		case voteRejected:
+			rejected++
+		default:
+			pending++
+		}
+	}
+
+	return accepted, rejected, pending
+}
+
+// join makes the client a participant. The context it sent is ignored, participants only change the context by
+// negotiating, so it is sent the current context to navigate to instead.
+func (m *Manager) join(client model.Client, message model.Message) {
+	m.Printf("Application '%v' joined the hub", client.Application())
+	m.setState(client, model.ClientSynced)
+	accept := util.NewSubAcceptMessage(APPLICATION_NAME, client.Version(), m.advertisedTimeout(), m.context)
+	accept.ReplyTo = message.ID
+	m.sendMessage(client, accept)
+}
+
+// propose starts a negotiation for a participant's context change request. Only one change is negotiated at a time.
+func (m *Manager) propose(client model.Client, message model.Message) {
+	if m.negotiation != nil {
+		reject := util.NewCtxRejectMessage(m.context, message.Context, OUTSTANDING_REQUEST_REASON, model.Conflict)
+		reject.ReplyTo = message.ID
+		m.sendMessage(client, reject)
+		return
+	}
+
+	m.setState(client, model.ClientVoting)
+	m.negotiate(client.ID(), message.ID, message.Context)
+}
+
+// proposeLocal starts a negotiation for a context change the user of this server asked for.
+func (m *Manager) proposeLocal(context []model.ContextItem) {
+	if m.negotiation != nil {
+		m.PrintErrString("Can't request a context change while another change is being negotiated")
+		return
+	}
+
+	if err := m.Keys.Validate(context); err != nil {
+		m.PrintErr(err, "error invalid context")
+		return
+	}
+
+	m.negotiate(LOCAL_PARTICIPANT, "", context)
+}
+
+// negotiate sends the proposed context to every participant but the originator and waits for their votes.
+func (m *Manager) negotiate(originator, requestID string, context []model.ContextItem) {
+	n := &negotiation{
+		originator: originator,
+		requestID:  requestID,
+		context:    util.CopyContext(context),
+		votes:      make(map[string]vote),
+	}
+	m.negotiation = n
+
+	for _, id := range m.order {
+		client := m.clients[id]
+		if id == originator || client.State() != model.ClientSynced {
+			continue
+		}
+
+		n.votes[id] = votePending
+		request := util.NewCtxChangeMessage(util.CopyContext(n.context))
+		request.ID = util.NewMessageID()
+		client.SetTransaction(request.ID)
+		m.setState(client, model.ClientOutstandingRequest)
+		m.sendMessage(client, request)
+	}
+
+	if originator != LOCAL_PARTICIPANT {
+		n.votes[LOCAL_PARTICIPANT] = votePending
+		m.voting = true
+		m.voteID = requestID
+		m.voteContext = util.CopyContext(n.context)
+	}
+
+	m.Printf("Negotiating '%v' with %v participants", util.FormatContext(n.context), len(n.votes))
+	m.startNegotiationTimer(n)
+	if m.voting && m.answerVote() {
+		return
+	}
+
+	m.decide()
+}
+
+// castVote records a participant's ctx-change-accept or ctx-change-reject.
+func (m *Manager) castVote(client model.Client, message model.Message) {
+	n := m.negotiation
+	if n == nil || n.votes[client.ID()] != votePending {
+		m.sendError(client, message.ID, fmt.Sprintf("%v sent without an outstanding request.", message.Kind), model.BadRequest)
+		return
+	}
+
+	if !m.repliesToOutstanding(client, message) {
+		return
+	}
+
+	client.SetTransaction("")
+	m.setState(client, model.ClientSynced)
+
+	if message.Kind == model.ContextChangeReject {
+		rejection := message.Rejection
+		if rejection == nil {
+			rejection = &model.MessageRejection{Reason: fmt.Sprintf("Rejected by %v.", client.Application()), Status: model.Conflict}
+		}
+		m.recordVote(client.ID(), voteRejected, rejection)
+		return
+	}
+
+	// An accept without context accepts what we asked for.
+	if len(message.Context) > 0 && !util.ContextEqual(message.Context, n.context) {
+		m.PrintErrString("'%v' accepted '%v' but we requested '%v'", client.Application(), util.FormatContext(message.Context), util.FormatContext(n.context))
+		m.recordVote(client.ID(), voteRejected, &model.MessageRejection{
+			Reason: fmt.Sprintf("%v accepted a different context.", client.Application()),
+			Status: model.Conflict,
+		})
+		return
+	}
+
+	m.recordVote(client.ID(), voteAccepted, nil)
+}
+
+// recordVote records a vote and commits or rolls back the change once the outcome is certain. The first rejection is
+// the one the originator is told about.
+func (m *Manager) recordVote(voter string, result vote, rejection *model.MessageRejection) {
+	n := m.negotiation
+	n.votes[voter] = result
+	if result == voteRejected && n.rejection == nil {
+		n.rejection = rejection
+	}
+	if voter == LOCAL_PARTICIPANT {
+		m.clearVote()
+	}
+
+	m.decide()
+}
+
+func (m *Manager) decide() {
+	n := m.negotiation
+	accepted, rejected, _ := n.count()
+	required := m.Quorum.required(len(n.votes))
+
+	switch {
+	case accepted >= required:
+		m.commit()
+	case rejected > len(n.votes)-required:
+		m.rollback()
+	}
+}
+
+// commit makes the proposed context the current context. Participants that rejected or didn't answer are sent a
+// ctx-update so they can catch up. Unless our user accepted, and the LIS already switched, the LIS switches now, and if
+// it can't the change is rolled back.
+func (m *Manager) commit() {
+	n := m.endNegotiation()
+
+	if n.votes[LOCAL_PARTICIPANT] != voteAccepted {
+		if err := m.navigate(n.context); err != nil {
+			m.navigationFailed(n, err)
+			return
+		}
+	}
+
+	m.context = util.CopyContext(n.context)
+
+	if originator := m.clients[n.originator]; originator != nil {
+		accept := util.NewCtxAcceptMessage(m.context)
+		accept.ReplyTo = n.requestID
+		m.setState(originator, model.ClientSynced)
+		m.sendMessage(originator, accept)
+	}
+
+	for id, vote := range n.votes {
+		if vote != voteAccepted {
+			m.resync(id)
+		}
+	}
+}
+
+// rollback keeps the current context. The originator is sent a ctx-change-reject with the first rejection and the
+// other participants a ctx-update, so those that already navigated go back.
+func (m *Manager) rollback() {
+	n := m.endNegotiation()
+	rejection := n.rejection
+	if rejection == nil {
+		rejection = &model.MessageRejection{Reason: "Context change rolled back.", Status: model.Conflict}
+	}
+	m.PrintErrString("Context change to '%v' rolled back: %v", util.FormatContext(n.context), rejection.Reason)
+
+	// We switched when we accepted, so switch back.
+	if n.votes[LOCAL_PARTICIPANT] == voteAccepted {
+		m.navigate(m.context)
+	}
+
+	if originator := m.clients[n.originator]; originator != nil {
+		reject := util.NewCtxRejectMessage(m.context, n.context, rejection.Reason, rejection.Status)
+		reject.ReplyTo = n.requestID
+		m.setState(originator, model.ClientSynced)
+		m.sendMessage(originator, reject)
+	}
+
+	for id := range n.votes {
+		m.resync(id)
+	}
+}
+
+// navigationFailed rolls back a change the participants accepted but the LIS couldn't switch to. They already switched,
+// so every participant is sent a ctx-update with a 500 error and the context we are on.
+func (m *Manager) navigationFailed(n *negotiation, err error) {
+	m.PrintErrString("Context change to '%v' rolled back: the LIS couldn't switch", util.FormatContext(n.context))
+
+	for id := range n.votes {
+		client := m.clients[id]
+		if client == nil {
+			continue
+		}
+
+		client.SetTransaction("")
+		m.setState(client, model.ClientSynced)
+		m.sendError(client, "", NavigationFailedReason(n.context, err), model.ServerError)
+	}
+}
+
+// resync sends a participant the current context and drops the request it still owes us an answer for.
+func (m *Manager) resync(id string) {
+	client := m.clients[id]
+	if client == nil {
+		return
+	}
+
+	client.SetTransaction("")
+	m.setState(client, model.ClientSynced)
+	m.sendMessage(client, util.NewCtxUpdateMessage(m.context))
+}
+
+func (m *Manager) endNegotiation() *negotiation {
+	n := m.negotiation
+	stopTimer(n.timer)
+	m.negotiation = nil
+	m.clearVote()
+	return n
+}
+
+// leaveNegotiation handles a participant disconnecting. A change proposed by it is rolled back, otherwise its vote no
+// longer counts.
+func (m *Manager) leaveNegotiation(client model.Client) {
+	n := m.negotiation
+	if n == nil {
+		return
+	}
+
+	if n.originator == client.ID() {
+		m.rollback()
+		return
+	}
+
+	if _, ok := n.votes[client.ID()]; ok {
+		delete(n.votes, client.ID())
+		m.decide()
+	}
+}
+
+func (m *Manager) startNegotiationTimer(n *negotiation) {
+	if m.Timeout <= 0 {
+		return
+	}
+
+	n.timer = time.AfterFunc(m.Timeout, func() {
+		m.post(func() {
+			m.negotiationTimedOut(n)
+		})
+	})
+}
+
+// negotiationTimedOut counts the votes that are still missing as rejections with a 408.
+func (m *Manager) negotiationTimedOut(n *negotiation) {
+	if m.negotiation != n {
+		return // The change was committed or rolled back before the timer fired.
+	}
+
+	m.PrintErrString("Negotiating '%v' timed out after %v", util.FormatContext(n.context), m.Timeout)
+	if n.rejection == nil {
+		n.rejection = &model.MessageRejection{Reason: "Context change request timed out.", Status: model.RequestTimeout}
+	}
+	for id, vote := range n.votes {
+		if vote == votePending {
+			n.votes[id] = voteRejected
+		}
+	}
+
+	m.decide()
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func newTestHub(t *testing.T, quorum QuorumRule, ids ...string) (*Manager, []*fakeClient) {
+	t.Helper()
+	m := newTestManager(t)
+	m.Hub = true
+	m.Quorum = quorum
+
+	participants := []*fakeClient{}
+	for _, id := range ids {
+		participant := connect(t, m, id)
+		if participant.State() != model.ClientSynced || participant.last(t).Kind != model.SyncAccept {
+			t.Fatalf("expected %v to join the hub, got %v", id, participant.State())
+		}
+		participants = append(participants, participant)
+	}
+
+	return m, participants
+}
+
+func answer(t *testing.T, m *Manager, client *fakeClient, kind model.MessageKind, rejection *model.MessageRejection) {
+	t.Helper()
+	request := client.last(t)
+	m.HandleMessage(client, model.Message{Kind: kind, ReplyTo: request.ID, Context: request.Context, Rejection: rejection})
+}
+
+func TestQuorumRequired(t *testing.T) {
+	tests := []struct {
+		rule     QuorumRule
+		voters   int
+		required int
+	}{
+		{QuorumAll, 3, 3},
+		{QuorumMajority, 3, 2},
+		{QuorumMajority, 4, 3},
+		{QuorumMajority, 1, 1},
+		{QuorumAny, 3, 1},
+		{QuorumAll, 0, 0},
+		{QuorumMajority, 0, 0},
+		{QuorumAny, 0, 0},
+	}
+
+	for _, test := range tests {
+		if required := test.rule.required(test.voters); required != test.required {
+			t.Fatalf("%v of %v: expected %v, got %v", test.rule, test.voters, test.required, required)
+		}
+	}
+
+	if _, err := ParseQuorumRule("most"); err == nil {
+		t.Fatalf("expected an unknown quorum rule to be rejected")
+	}
+}
+
+func TestHubCommitsWhenAllAccept(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis", "viewer")
+	fusion, lis, viewer := participants[0], participants[1], participants[2]
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+	for _, participant := range []*fakeClient{lis, viewer} {
+		if request := participant.last(t); request.Kind != model.ContextChangeRequest || participant.State() != model.ClientOutstandingRequest {
+			t.Fatalf("expected %v to be asked, got %v %+v", participant.id, participant.State(), request)
+		}
+	}
+	if !m.Snapshot().Voting || fusion.State() != model.ClientVoting {
+		t.Fatalf("expected the local user to vote too")
+	}
+
+	answer(t, m, lis, model.ContextChangeAccept, nil)
+	answer(t, m, viewer, model.ContextChangeAccept, nil)
+	if m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("the change must wait for the local vote")
+	}
+
+	m.Accept()
+	accept := fusion.last(t)
+	if accept.Kind != model.ContextChangeAccept || accept.ReplyTo != "request-1" || m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected the change to commit, got %+v on %v", accept, m.Snapshot().CurrentCase())
+	}
+	for _, participant := range participants {
+		if participant.State() != model.ClientSynced {
+			t.Fatalf("expected %v to be synced, got %v", participant.id, participant.State())
+		}
+	}
+}
+
+func TestHubRollsBackOnRejection(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis", "viewer")
+	fusion, lis, viewer := participants[0], participants[1], participants[2]
+	m.AutoAccept = true
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+	answer(t, m, lis, model.ContextChangeAccept, nil)
+	answer(t, m, viewer, model.ContextChangeReject, &model.MessageRejection{Reason: "Slide not scanned.", Status: model.Conflict})
+
+	reject := fusion.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Reason != "Slide not scanned." || reject.ReplyTo != "request-1" {
+		t.Fatalf("expected the originator to get the rejector's reason, got %+v", reject)
+	}
+	if CaseNumberFromContext(reject.CurrentContext) != "N123456" || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected the context to stay on N123456, got %v", m.Snapshot().CurrentCase())
+	}
+	if update := lis.last(t); update.Kind != model.ContextUpdate || CaseNumberFromContext(update.Context) != "N123456" {
+		t.Fatalf("expected the participant that accepted to be rolled back, got %+v", update)
+	}
+}
+
+func TestHubMajority(t *testing.T) {
+	m, participants := newTestHub(t, QuorumMajority, "fusion", "lis", "viewer")
+	fusion, lis, viewer := participants[0], participants[1], participants[2]
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+	answer(t, m, lis, model.ContextChangeAccept, nil)
+	m.Accept()
+
+	if fusion.last(t).Kind != model.ContextChangeAccept || m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected two of three to commit the change")
+	}
+	if update := viewer.last(t); update.Kind != model.ContextUpdate || CaseNumberFromContext(update.Context) != "N2" || viewer.State() != model.ClientSynced {
+		t.Fatalf("expected the participant that didn't answer to be sent the new context, got %+v", update)
+	}
+}
+
+func TestHubOneChangeAtATime(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	fusion, lis := participants[0], participants[1]
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+	m.HandleMessage(lis, model.Message{Kind: model.ContextChangeRequest, ID: "crossing", Context: caseContext("N3")})
+
+	reject := lis.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.Conflict || reject.ReplyTo != "crossing" {
+		t.Fatalf("expected the second change to be rejected with a 409, got %+v", reject)
+	}
+}
+
+func TestHubLocalProposal(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+
+	m.ContextChangeRequest(caseContext("N2"))
+	if negotiation := m.Snapshot().Negotiation; negotiation == nil || negotiation.Pending != 2 {
+		t.Fatalf("expected both participants to be asked, got %+v", negotiation)
+	}
+
+	for _, participant := range participants {
+		answer(t, m, participant, model.ContextChangeAccept, nil)
+	}
+	if m.Snapshot().CurrentCase() != "N2" || m.Snapshot().Negotiation != nil {
+		t.Fatalf("expected the change to commit")
+	}
+}
+
+func TestHubOriginatorDisconnects(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	fusion, lis := participants[0], participants[1]
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+	answer(t, m, lis, model.ContextChangeAccept, nil)
+	m.Do(func() { m.handleDisconnect(fusion) })
+
+	if update := lis.last(t); update.Kind != model.ContextUpdate || CaseNumberFromContext(update.Context) != "N123456" {
+		t.Fatalf("expected the change to be rolled back, got %+v", update)
+	}
+	if m.Snapshot().Voting {
+		t.Fatalf("expected the local vote to be cleared")
+	}
+}
+
+func TestHubTimesOut(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	fusion := participants[0]
+	m.Timeout = 10 * time.Millisecond
+	m.AutoAccept = true
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+
+	deadline := time.Now().Add(time.Second)
+	for m.Snapshot().Negotiation != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var reject model.Message
+	m.Do(func() { reject = fusion.last(t) })
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.RequestTimeout {
+		t.Fatalf("expected a 408 rejection, got %+v", reject)
+	}
+}
+
+func TestHubLocalProposalNavigates(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	navigator := NewFakeNavigator(nil, 0)
+	m.Do(func() { m.Navigator = navigator })
+
+	m.ContextChangeRequest(caseContext("N2"))
+	for _, participant := range participants {
+		answer(t, m, participant, model.ContextChangeAccept, nil)
+	}
+
+	if current, err := navigator.Current(); err != nil || CaseNumberFromContext(current) != "N2" {
+		t.Fatalf("expected the LIS to switch to N2, got %v %v", current, err)
+	}
+}
+
+func TestHubRemoteProposalNavigatesWithoutLocalVote(t *testing.T) {
+	m, participants := newTestHub(t, QuorumMajority, "fusion", "lis", "viewer")
+	fusion, lis, viewer := participants[0], participants[1], participants[2]
+	navigator := NewFakeNavigator(nil, 0)
+	m.Do(func() { m.Navigator = navigator })
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+	answer(t, m, lis, model.ContextChangeAccept, nil)
+	answer(t, m, viewer, model.ContextChangeAccept, nil)
+
+	if accept := fusion.last(t); accept.Kind != model.ContextChangeAccept || m.Snapshot().Voting {
+		t.Fatalf("expected the change to commit without the local vote, got %+v", accept)
+	}
+	if current, err := navigator.Current(); err != nil || CaseNumberFromContext(current) != "N2" {
+		t.Fatalf("expected the LIS to follow the quorum to N2, got %v %v", current, err)
+	}
+}
+
+func TestHubLocalProposalNavigationFails(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	m.Do(func() { m.Navigator = NewFakeNavigator([]string{"N666"}, 0) })
+
+	m.ContextChangeRequest(caseContext("N666"))
+	for _, participant := range participants {
+		answer(t, m, participant, model.ContextChangeAccept, nil)
+	}
+
+	if m.Snapshot().CurrentCase() != "N123456" || m.Snapshot().Negotiation != nil {
+		t.Fatalf("expected the change to roll back, got %v", m.Snapshot().CurrentCase())
+	}
+	for _, participant := range participants {
+		update := participant.last(t)
+		if update.Kind != model.ContextUpdate || update.Error == nil || update.Error.Status != model.ServerError || CaseNumberFromContext(update.Context) != "N123456" {
+			t.Fatalf("expected %v to be sent a ctx-update with a 500 error, got %+v", participant.id, update)
+		}
+		if participant.State() != model.ClientSynced {
+			t.Fatalf("expected %v to be synced, got %v", participant.id, participant.State())
+		}
+	}
+}
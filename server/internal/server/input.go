@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// ContextFromInput turns user input into the context to request. A bare case number keeps the rest of the current
+// context and only replaces the case, otherwise the input is parsed as the full set of "key=value" pairs. It only reads
+// configuration so it is safe to call from any goroutine.
+func (m *Manager) ContextFromInput(input string, current []model.ContextItem) ([]model.ContextItem, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("no context entered")
+	}
+
+	context := util.WithContextValue(current, model.CaseNumber, input)
+	if strings.Contains(input, "=") {
+		var err error
+		context, err = util.ParseContext(input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m.System != "" {
+		for i := range context {
+			if context[i].System == "" {
+				context[i].System = m.System
+			}
+		}
+	}
+
+	if err := m.Keys.Validate(context); err != nil {
+		return nil, err
+	}
+
+	return context, nil
+}
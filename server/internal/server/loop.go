@@ -0,0 +1,298 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// Run processes commands and disconnects until Stop is called. It is the only goroutine that touches the manager's
+// state, so nothing needs a lock.
+func (m *Manager) Run() {
+	for {
+		select {
+		case command := <-m.commands:
+			command.run()
+			m.settle()
+			if command.finished != nil {
+				close(command.finished)
+			}
+		case client := <-m.disconnect:
+			m.handleDisconnect(client)
+			m.settle()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// settle sends what follows from the last command, whatever it changed: queue positions to waiting clients and the
+// committed context to observers.
+func (m *Manager) settle() {
+	m.updateQueue()
+	m.broadcast()
+}
+
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+// Done is closed when the manager stops.
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
+
+// command is work for the manager goroutine. finished, if set, is closed once the command and everything that follows
+// from it, like queue updates, is done.
+type command struct {
+	run      func()
+	finished chan struct{}
+}
+
+// post hands a command to the manager goroutine without waiting for it to run. It returns false if the manager stopped.
+// It must not be called from the manager goroutine.
+func (m *Manager) post(run func()) bool {
+	return m.send(command{run: run})
+}
+
+func (m *Manager) send(command command) bool {
+	select {
+	case m.commands <- command:
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// Do runs the command on the manager goroutine and waits for it to finish. It must not be called from the manager
+// goroutine.
+func (m *Manager) Do(run func()) {
+	finished := make(chan struct{})
+	if m.send(command{run: run, finished: finished}) {
+		<-finished
+	}
+}
+
+func (m *Manager) AddClient(client model.Client) {
+	m.Do(func() {
+		m.addClient(client)
+	})
+}
+
+// ReceiveMessage handles a raw message from a transport. It waits until the message is handled so each client's
+// messages are handled in the order they arrived.
+func (m *Manager) ReceiveMessage(client model.Client, msg []byte) {
+	m.Do(func() {
+		m.receiveMessage(client, msg)
+	})
+}
+
+func (m *Manager) HandleMessage(client model.Client, message model.Message) {
+	m.Do(func() {
+		m.handleMessage(client, message)
+	})
+}
+
+func (m *Manager) SendMessage(client model.Client, message model.Message) {
+	m.Do(func() {
+		m.sendMessage(client, message)
+	})
+}
+
+// Accept accepts the client's context change request the user is voting on.
+func (m *Manager) Accept() {
+	m.Do(func() {
+		if m.voting {
+			m.accept()
+		}
+	})
+}
+
+// Reject rejects the client's context change request the user is voting on.
+func (m *Manager) Reject() {
+	m.Do(func() {
+		if m.voting {
+			m.reject()
+		}
+	})
+}
+
+// RejectWithReason rejects the client's context change request the user is voting on with the reason and status, for
+// example "Unsaved report." and 409.
+func (m *Manager) RejectWithReason(reason string, status model.StatusCode) {
+	m.Do(func() {
+		if m.voting {
+			m.rejectWith(&model.MessageRejection{Reason: reason, Status: status})
+		}
+	})
+}
+
+// ContextChangeRequest asks the synchronized client to change to the context. With no synchronized client there is
+// nobody to ask, so the context is changed right away. When a guard vetoes the change nothing happens and the veto is
+// returned as a *VetoError.
+func (m *Manager) ContextChangeRequest(context []model.ContextItem) error {
+	var err error
+	m.Do(func() {
+		if rejection := m.guard("", context); rejection != nil {
+			err = &VetoError{Rejection: *rejection}
+			return
+		}
+
+		if m.Hub {
+			m.proposeLocal(context)
+			return
+		}
+
+		if m.syncedClientID == "" {
+			m.context = util.CopyContext(context)
+			return
+		}
+
+		m.contextChangeRequest(context)
+	})
+
+	return err
+}
+
+// Promote makes a waiting client the synchronized client. With an empty clientID the selection policy picks one.
+func (m *Manager) Promote(clientID string) {
+	m.Do(func() {
+		m.promoteWaiting(clientID)
+	})
+}
+
+// ClientSnapshot describes a connected client.
+type ClientSnapshot struct {
+	ID          string            `json:"id"`
+	Application string            `json:"application"`
+	State       model.ClientState `json:"state"`
+	Queue       *model.QueueInfo  `json:"queue,omitempty"` // Set while the client is waiting.
+}
+
+// NegotiationSnapshot describes a context change being negotiated in hub mode.
+type NegotiationSnapshot struct {
+	Context    []model.ContextItem `json:"context"`
+	Originator string              `json:"originator"` // The originator's application, empty when we proposed it.
+	Accepted   int                 `json:"accepted"`
+	Rejected   int                 `json:"rejected"`
+	Pending    int                 `json:"pending"`
+}
+
+// Snapshot is a copy of the manager state for the TUI and the control endpoint.
+type Snapshot struct {
+	ClientCount        int                  `json:"client_count"`
+	Clients            []ClientSnapshot     `json:"clients"` // In the order they connected.
+	Context            []model.ContextItem  `json:"context"`
+	Voting             bool                 `json:"voting"`
+	VoteContext        []model.ContextItem  `json:"vote_context,omitempty"`
+	VoteRule           string               `json:"vote_rule,omitempty"`     // The accept rule that asked the user about the request.
+	LastDecision       *RuleDecision        `json:"last_decision,omitempty"` // The last request an accept rule answered on its own.
+	Outstanding        bool                 `json:"outstanding"`
+	OutstandingContext []model.ContextItem  `json:"outstanding_context,omitempty"`
+	Collision          bool                 `json:"collision"`
+	Hub                bool                 `json:"hub"`
+	Negotiation        *NegotiationSnapshot `json:"negotiation,omitempty"`
+}
+
+func (m *Manager) Snapshot() Snapshot {
+	var snapshot Snapshot
+	m.Do(func() {
+		snapshot = Snapshot{
+			ClientCount:        len(m.clients),
+			Context:            util.CopyContext(m.context),
+			Voting:             m.voting,
+			VoteContext:        util.CopyContext(m.voteContext),
+			VoteRule:           m.voteRule,
+			Outstanding:        m.outstanding,
+			OutstandingContext: util.CopyContext(m.outstandingContext),
+			Collision:          m.collision,
+			Hub:                m.Hub,
+		}
+
+		if d := m.lastDecision; d != nil {
+			decision := *d
+			decision.Context = util.CopyContext(d.Context)
+			snapshot.LastDecision = &decision
+		}
+
+		if n := m.negotiation; n != nil {
+			accepted, rejected, pending := n.count()
+			snapshot.Negotiation = &NegotiationSnapshot{
+				Context:  util.CopyContext(n.context),
+				Accepted: accepted,
+				Rejected: rejected,
+				Pending:  pending,
+			}
+			if originator := m.clients[n.originator]; originator != nil {
+				snapshot.Negotiation.Originator = originator.Application()
+			}
+		}
+
+		for _, id := range m.order {
+			client := m.clients[id]
+			clientSnapshot := ClientSnapshot{ID: id, Application: client.Application(), State: client.State()}
+			if queue := m.clientInfo[id].queue; queue.Position > 0 {
+				clientSnapshot.Queue = &queue
+			}
+			snapshot.Clients = append(snapshot.Clients, clientSnapshot)
+		}
+	})
+
+	return snapshot
+}
+
+// CurrentCase is the case number in the current context. The context is the source of truth, the case number is only
+// what the TUI displays.
+func (s Snapshot) CurrentCase() string {
+	return CaseNumberFromContext(s.Context)
+}
+
+// VoteCase is the case number in the client's context change request.
+func (s Snapshot) VoteCase() string {
+	return CaseNumberFromContext(s.VoteContext)
+}
+
+// WaitingCount is how many clients are waiting to be synchronized.
+func (s Snapshot) WaitingCount() int {
+	return s.countState(model.ClientWaiting)
+}
+
+// ObserverCount is how many read-only observers are connected.
+func (s Snapshot) ObserverCount() int {
+	return s.countState(model.ClientObserving)
+}
+
+func (s Snapshot) countState(state model.ClientState) int {
+	count := 0
+	for _, client := range s.Clients {
+		if client.State == state {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Queue is the waiting clients in queue order.
+func (s Snapshot) Queue() []ClientSnapshot {
+	queue := []ClientSnapshot{}
+	for _, client := range s.Clients {
+		if client.Queue != nil {
+			queue = append(queue, client)
+		}
+	}
+
+	slices.SortFunc(queue, func(a, b ClientSnapshot) int {
+		return a.Queue.Position - b.Queue.Position
+	})
+
+	return queue
+}
+
+// OutstandingCase is the case number in the context change request we sent.
+func (s Snapshot) OutstandingCase() string {
+	return CaseNumberFromContext(s.OutstandingContext)
+}
@@ -3,77 +3,137 @@ package server
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"slices"
 	"strings"
-	"tcs/internal/model"
-	"tcs/internal/util"
-	ws "tcs/internal/websocket"
+	"sync"
 	"time"
 
+	"github.com/Techcyte/context-sync/server/internal/events"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/registry"
+	"github.com/Techcyte/context-sync/server/internal/util"
+	ws "github.com/Techcyte/context-sync/server/internal/websocket"
+
 	"github.com/gorilla/websocket"
 )
 
 const APPLICATION_NAME = "techcyte-context-sync"
-const DEFAULT_TIMEOUT = 30 // In seconds.
+const DEFAULT_TIMEOUT = 30 * time.Second
 
+// Manager owns the protocol state. Everything below the configuration fields is only touched by the goroutine running
+// Run. Transports and the TUI talk to it through the exported methods, which hand the work to that goroutine.
 type Manager struct {
-	Address        string                  // The address we are listening on.
-	Clients        map[string]model.Client // A map of client ids to clients.
-	SyncedClientID string                  // The client id for the currently synchronized client.
-	disconnect     chan model.Client       // Used to track when clients disconnect.
-	Upgrader       websocket.Upgrader      // Used for the websocket connection.
-	Context        []model.ContextItem     // The current context.
-	VoteContext    []model.ContextItem     // The context in the context change request.
-
-	// For the TUI
-	CurrentCase   string   // The case number that is displayed to the user. This is the case number in the current context.
-	Voting        bool     // "Voting" in this context means the client has send a context change request and the server has to accept or reject it.
-	VoteCase      string   // The case number in the context change request to be accepted or rejected.
-	AutoAccept    bool     // If true any context change request will be automatically accepted.
-	MessagesToAdd []string // Used for printing to the console in the TUI.
+	// Configuration. Set these before calling Run.
+	Address         string               // The address we are listening on.
+	Upgrader        websocket.Upgrader   // Used for the websocket connection.
+	AutoAccept      bool                 // If true any context change request no accept rule decides is automatically accepted.
+	CollisionPolicy CollisionPolicy      // How to answer the client's request when the requests cross.
+	MinVersion      float64              // The lowest protocol version we support.
+	MaxVersion      float64              // The highest protocol version we support.
+	Keys            *registry.Registry   // The known context keys, used to validate context.
+	System          string               // Our system or assigning authority, added to context we originate. Optional.
+	TakeoverPolicy  TakeoverPolicy       // What happens to the synchronized client when another client asks to replace it.
+	Timeout         time.Duration        // How long a context change request may wait for an answer. Zero disables the deadline.
+	Events          *events.Bus          // Everything that happens is published here for the TUI, logs and integrations.
+	SelectionPolicy SelectionPolicy      // Picks the next synchronized client on disconnect, takeover and promotion.
+	Hub             bool                 // Every client is a participant and changes are negotiated between all of them, see hub.go.
+	Quorum          QuorumRule           // How many participants have to accept a change in hub mode.
+	Navigator       Navigator            // Switches the LIS to a new context. Optional, without it every switch succeeds.
+	Guards          []ContextChangeGuard // Can veto a context change before it is accepted or sent, in order, see guard.go.
+	AcceptRules     []AcceptRule         // Decide the client's context change requests before the user does, see rules.go.
+
+	// Channels into the manager goroutine.
+	commands   chan command      // Work to run on the manager goroutine.
+	disconnect chan model.Client // Used to track when clients disconnect.
+	done       chan struct{}     // Closed when the manager stops.
+	stopOnce   sync.Once
+
+	// State owned by the manager goroutine.
+	clients            map[string]model.Client // A map of client ids to clients.
+	order              []string                // Client ids in the order they connected.
+	clientInfo         map[string]clientInfo   // What else we know about each client, by client id.
+	syncedClientID     string                  // The client id for the currently synchronized client.
+	context            []model.ContextItem     // The current context.
+	voting             bool                    // "Voting" in this context means the client has send a context change request and the server has to accept or reject it.
+	voteContext        []model.ContextItem     // The context in the client's context change request.
+	voteID             string                  // The id of the client's context change request, echoed in our reply.
+	voteRule           string                  // The accept rule that matched the client's request, if any.
+	lastDecision       *RuleDecision           // The last request an accept rule answered on its own.
+	outstanding        bool                    // True while a context change request we sent is waiting for the client to answer it.
+	outstandingContext []model.ContextItem     // The context in the context change request we sent.
+	collision          bool                    // True when the client's context change request crossed our outstanding request.
+	outstandingTimer   *time.Timer             // Fires when our outstanding request expires.
+	voteTimer          *time.Timer             // Fires when the client's request expires before the user votes.
+	shuttingDown       bool                    // Set by Shutdown, clients that connect afterwards are closed right away.
+	broadcastContext   []model.ContextItem     // The context observers were last sent.
+	negotiation        *negotiation            // The context change being negotiated in hub mode.
+}
+
+// clientInfo is what the manager remembers about a client besides what the client itself tracks.
+type clientInfo struct {
+	connectedAt  time.Time
+	lastActive   time.Time       // When the client last sent a message.
+	capabilities []string        // The capabilities the client listed in its sync-request.
+	queue        model.QueueInfo // The queue position we last told the client about, zero when it isn't waiting.
 }
 
 func NewManager(address, startingCase string) *Manager {
-	// See https://pkg.go.dev/github.com/gorilla/websocket
-	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+	return NewManagerWithContext(address, DemoContext(startingCase))
+}
+
+// DemoContext is the context the demo server starts with, a made up patient and order for the case.
+func DemoContext(caseNumber string) []model.ContextItem {
+	return []model.ContextItem{
+		{Key: "patient", Value: "p-123456"},
+		{Key: "order", Value: "o-654321"},
+		{Key: "case", Value: caseNumber},
 	}
+}
+
+// NewManagerWithContext is NewManager with the full initial context rather than a demo context for the case.
+func NewManagerWithContext(address string, context []model.ContextItem) *Manager {
+	// See https://pkg.go.dev/github.com/gorilla/websocket. Without a CheckOrigin only pages from the same host may
+	// connect.
+	upgrader := websocket.Upgrader{}
 
 	return &Manager{
-		Address:    address,
-		Upgrader:   upgrader,
-		Clients:    make(map[string]model.Client),
-		disconnect: make(chan model.Client),
-		Context: []model.ContextItem{
-			{Key: "patient", Value: "p-123456"},
-			{Key: "order", Value: "o-654321"},
-			{Key: "case", Value: startingCase},
-		},
-		CurrentCase: startingCase,
+		Address:          address,
+		Upgrader:         upgrader,
+		CollisionPolicy:  CollisionAsk,
+		Timeout:          DEFAULT_TIMEOUT,
+		TakeoverPolicy:   TakeoverWait,
+		Quorum:           QuorumAll,
+		Keys:             registry.Default(),
+		MinVersion:       MIN_PROTOCOL_VERSION,
+		MaxVersion:       MAX_PROTOCOL_VERSION,
+		commands:         make(chan command),
+		disconnect:       make(chan model.Client),
+		Events:           events.NewBus(),
+		done:             make(chan struct{}),
+		SelectionPolicy:  FIFOPolicy{},
+		clients:          make(map[string]model.Client),
+		clientInfo:       make(map[string]clientInfo),
+		context:          util.CopyContext(context),
+		broadcastContext: util.CopyContext(context),
 	}
 }
 
 func Serve(manager *Manager, w http.ResponseWriter, r *http.Request) {
 	conn, err := manager.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		manager.PrintErr(err, "error upgrading connection")
 		return
 	}
 
 	_, msg, err := conn.ReadMessage()
 	if err != nil {
 		manager.PrintErr(err, "error reading message")
+		conn.Close()
 		return
 	}
 
-	client, err := ws.NewWebsocketClient(manager, conn, msg)
-	if err != nil {
-		manager.PrintErr(err, "error failed to create new client")
-		return
-	}
+	client := ws.NewWebsocketClient(manager, conn, msg)
 	manager.AddClient(client)
 
 	go client.Read()
@@ -82,40 +142,56 @@ func Serve(manager *Manager, w http.ResponseWriter, r *http.Request) {
 	manager.ReceiveMessage(client, msg)
 }
 
-// Print functions to print to the console in the TUI.
+// Publish sends an event to every subscriber of the event bus. It is safe to call from any goroutine.
+func (m *Manager) Publish(event model.Event) {
+	m.Events.Publish(event)
+}
+
+// Print functions publish info and error events for anything that isn't covered by a more specific event kind.
 func (m *Manager) Println(msg string) {
-	m.MessagesToAdd = append(m.MessagesToAdd, msg)
+	m.Publish(model.Event{Kind: model.EventInfo, Text: msg})
 }
 
 func (m *Manager) Printf(msgFmt string, args ...any) {
-	msg := fmt.Sprintf(msgFmt, args...)
-	m.MessagesToAdd = append(m.MessagesToAdd, msg)
+	m.Println(fmt.Sprintf(msgFmt, args...))
 }
 
 func (m *Manager) PrintErr(err error, msgFmt string, args ...any) {
 	msgFmt = strings.Replace(msgFmt, "error ", "", 1)
-
-	msg := fmt.Sprintf(msgFmt, args...)
-	msg = fmt.Sprintf("\033[91mError\033[0m %v: %v", msg, err.Error())
-	m.MessagesToAdd = append(m.MessagesToAdd, msg)
+	m.Publish(model.Event{Kind: model.EventError, Text: fmt.Sprintf(msgFmt, args...), Err: err})
 }
 
 func (m *Manager) PrintErrString(msgFmt string, args ...any) {
-	msg := fmt.Sprintf(msgFmt, args...)
-	msg = fmt.Sprintf("\033[91mError\033[0m: %v", msg)
-	m.MessagesToAdd = append(m.MessagesToAdd, msg)
+	m.Publish(model.Event{Kind: model.EventError, Text: fmt.Sprintf(msgFmt, args...)})
+}
+
+func (m *Manager) publishClientEvent(kind model.EventKind, client model.Client) {
+	m.Publish(model.Event{Kind: kind, ClientID: client.ID(), Application: client.Application(), State: client.State()})
 }
 
-func (m *Manager) AddClient(client model.Client) {
-	m.Printf("Application \033[94m'%v'\033[0m connected", client.Application())
-	m.Clients[client.ID()] = client
+func (m *Manager) addClient(client model.Client) {
+	now := time.Now()
+	m.clients[client.ID()] = client
+	m.order = append(m.order, client.ID())
+	m.clientInfo[client.ID()] = clientInfo{connectedAt: now, lastActive: now}
+	m.publishClientEvent(model.EventClientConnected, client)
+
+	if m.shuttingDown {
+		m.closeForShutdown(client)
+	}
 }
 
-func (m *Manager) ClientCount() int {
-	return len(m.Clients)
+// setState moves the client to a new state and publishes the change.
+func (m *Manager) setState(client model.Client, state model.ClientState) {
+	if client.State() == state {
+		return
+	}
+
+	client.SetState(state)
+	m.publishClientEvent(model.EventStateChanged, client)
 }
 
-func (m *Manager) CaseNumberFromContext(context []model.ContextItem) string {
+func CaseNumberFromContext(context []model.ContextItem) string {
 	if len(context) == 0 {
 		return ""
 	}
@@ -129,169 +205,442 @@ func (m *Manager) CaseNumberFromContext(context []model.ContextItem) string {
 	return ""
 }
 
-func (m *Manager) SetCurrentCaseFromContext() {
-	m.CurrentCase = m.CaseNumberFromContext(m.Context)
+func (m *Manager) handleMessage(client model.Client, message model.Message) {
+	if info, ok := m.clientInfo[client.ID()]; ok {
+		info.lastActive = time.Now()
+		m.clientInfo[client.ID()] = info
+	}
+
+	if !IsKnownMessageKind(message.Kind) {
+		m.Printf("Unknown message kind '%v'", message.Kind)
+		m.sendError(client, message.ID, fmt.Sprintf("Unknown message kind '%v'.", message.Kind), model.BadRequest)
+		return
+	}
+
+	if !CanReceive(client.State(), message.Kind) {
+		m.PrintErrString("'%v' is not valid while '%v' is %v", message.Kind, client.Application(), client.State())
+		m.sendError(client, message.ID, fmt.Sprintf("%v sent while %v.", message.Kind, client.State()), model.BadRequest)
+		return
+	}
+
+	if message.Kind == model.SyncRequest {
+		m.handleSyncRequest(client, message)
+		return
+	}
+
+	handler, ok := protocolHandlers[client.Version()]
+	if !ok {
+		m.PrintErrString("No handler for protocol version %v", client.Version())
+		m.sendError(client, message.ID, fmt.Sprintf("Protocol version %v is not supported.", client.Version()), model.ServerError)
+		return
+	}
+
+	handler(m, client, message)
 }
 
-func (m *Manager) HandleMessage(client model.Client, message model.Message) {
-	switch message.Kind {
-	case model.SyncRequest:
-		timeout := (time.Second * DEFAULT_TIMEOUT).Seconds()
-		if m.SyncedClientID != "" {
-			message := util.NewSubRejectMessage(APPLICATION_NAME, &timeout, "Already have a synchronized client.", model.ConflictWithRetry)
-			m.SendMessage(client, message)
+// handleSyncRequest negotiates the protocol version and synchronizes the client or puts it in the waiting pool.
+func (m *Manager) handleSyncRequest(client model.Client, message model.Message) {
+	m.setState(client, model.ClientSyncing)
 
-			return
+	version, status := m.negotiateVersion(message.Info)
+	if status != 0 {
+		m.rejectVersion(client, message.Info, status)
+		return
+	}
+	client.SetVersion(version)
+	if info, ok := m.clientInfo[client.ID()]; ok {
+		info.capabilities = message.Info.Capabilities
+		m.clientInfo[client.ID()] = info
+	}
+
+	if message.Info.Role == model.RoleObserver {
+		m.observe(client, message)
+		return
+	}
+
+	if err := m.Keys.Validate(message.Context); err != nil {
+		m.PrintErr(err, "error invalid initial context from '%v'", client.Application())
+		m.setState(client, model.ClientConnected)
+		reject := util.NewSubRejectMessage(APPLICATION_NAME, version, m.advertisedTimeout(), InvalidContextReason(err), model.BadRequest)
+		reject.ReplyTo = message.ID
+		m.sendMessage(client, reject)
+		return
+	}
+
+	if m.Hub {
+		m.join(client, message)
+		return
+	}
+
+	if m.syncedClientID != "" && m.wantsTakeover(message) {
+		if next := m.selectClient(SelectOnTakeover, client); next != nil && next.ID() == client.ID() {
+			m.takeover()
 		}
+	}
+
+	if m.syncedClientID != "" {
+		m.setState(client, model.ClientWaiting)
+		reject := util.NewSubRejectMessage(APPLICATION_NAME, version, m.advertisedTimeout(), "Already have a synchronized client.", model.ConflictWithRetry)
+		reject.ReplyTo = message.ID
+		m.sendMessage(client, reject)
 
-		if len(message.Context) > 0 {
-			m.CurrentCase = m.CaseNumberFromContext(message.Context)
-			m.Context = message.Context
+		return
+	}
+
+	// When a guard vetoes the client's initial context or we can't switch to it we accept the client without it and ask
+	// it to switch to ours instead.
+	initialContextFailed := false
+	if len(message.Context) > 0 {
+		if rejection := m.guard(client.Application(), message.Context); rejection != nil {
+			initialContextFailed = true
+		} else if err := m.navigate(message.Context); err != nil {
+			initialContextFailed = true
+		} else {
+			m.context = util.CopyContext(message.Context)
 		}
+	}
+
+	m.syncedClientID = client.ID()
+	m.setState(client, model.ClientSynced)
+	acceptContext := m.context
+	if initialContextFailed {
+		acceptContext = nil
+	}
+	accept := util.NewSubAcceptMessage(APPLICATION_NAME, version, m.advertisedTimeout(), acceptContext)
+	accept.ReplyTo = message.ID
+	m.sendMessage(client, accept)
 
-		m.SyncedClientID = client.ID()
-		message := util.NewSubAcceptMessage(APPLICATION_NAME, &timeout, m.CurrentCase)
-		m.SendMessage(client, message)
+	if initialContextFailed {
+		m.contextChangeRequest(m.context)
+	}
+}
+
+// handleMessageV1 handles every message after a client negotiated version 1 of the protocol.
+func (m *Manager) handleMessageV1(client model.Client, message model.Message) {
+	switch message.Kind {
 	case model.ContextChangeRequest:
 		if len(message.Context) == 0 {
 			m.Printf("Empty context on '%v' event.", model.ContextChangeRequest)
+			m.sendError(client, message.ID, fmt.Sprintf("%v sent with no context.", model.ContextChangeRequest), model.BadRequest)
+			return
+		}
+
+		if err := m.Keys.Validate(message.Context); err != nil {
+			m.PrintErr(err, "error invalid context from '%v'", client.Application())
+			reject := util.NewCtxRejectMessage(m.context, message.Context, InvalidContextReason(err), model.BadRequest)
+			reject.ReplyTo = message.ID
+			m.sendMessage(client, reject)
 			return
 		}
 
-		m.VoteContext = message.Context
-		m.VoteCase = m.CaseNumberFromContext(message.Context)
-		m.Voting = true
+		if m.Hub {
+			m.propose(client, message)
+			return
+		}
 
-		if m.AutoAccept {
-			m.Accept()
+		if m.voting {
+			reject := util.NewCtxRejectMessage(m.context, message.Context, OUTSTANDING_REQUEST_REASON, model.Conflict)
+			reject.ReplyTo = message.ID
+			m.sendMessage(client, reject)
+			return
 		}
+
+		m.voteID = message.ID
+		m.voteContext = util.CopyContext(message.Context)
+		m.voting = true
+		m.setSyncedState(client)
+		m.startVoteTimer()
+
+		if m.outstanding {
+			m.handleCollision()
+			return
+		}
+
+		m.answerVote()
 	case model.ContextChangeAccept:
-		m.Context = []model.ContextItem{}
-		m.Context = append(m.Context, m.VoteContext...)
-		m.CurrentCase = m.VoteCase
+		if m.Hub {
+			m.castVote(client, message)
+			return
+		}
+
+		if !m.repliesToOutstanding(client, message) {
+			return
+		}
+
+		// An accept without context accepts what we asked for.
+		if len(message.Context) > 0 && !util.ContextEqual(message.Context, m.outstandingContext) {
+			m.PrintErrString("Out of sync with '%v'! It accepted '%v' but we requested '%v'", client.Application(), util.FormatContext(message.Context), util.FormatContext(m.outstandingContext))
+			m.clearOutstanding()
+			m.setSyncedState(client)
+			m.sendError(client, message.ID, fmt.Sprintf("%v context doesn't match the request.", model.ContextChangeAccept), model.Conflict)
+			return
+		}
+
+		requestedContext := util.CopyContext(m.outstandingContext)
+		m.clearOutstanding()
+		m.setSyncedState(client)
 
-		m.VoteContext = []model.ContextItem{}
-		m.VoteCase = ""
+		// The client already switched, if we can't follow we tell it where we are.
+		if err := m.navigate(requestedContext); err != nil {
+			m.PrintErrString("Out of sync with '%v'! It switched to '%v' but we couldn't", client.Application(), util.FormatContext(requestedContext))
+			m.sendError(client, message.ID, NavigationFailedReason(requestedContext, err), model.ServerError)
+			return
+		}
+
+		m.context = requestedContext
 	case model.ContextChangeReject:
-		m.VoteContext = []model.ContextItem{}
-		m.VoteCase = ""
+		if m.Hub {
+			m.castVote(client, message)
+			return
+		}
+
+		if !m.repliesToOutstanding(client, message) {
+			return
+		}
+
+		if m.collision && message.Rejection != nil && message.Rejection.Status == model.Conflict {
+			m.Printf("'%v' rejected our request for '%v' because of its outstanding request", client.Application(), util.FormatContext(m.outstandingContext))
+		}
+
+		m.clearOutstanding()
+		m.setSyncedState(client)
 	case model.ContextUpdateRequest:
-		m.SendMessage(client, model.Message{
-			Kind:    model.ContextUpdate,
-			Context: m.Context,
-		})
+		update := util.NewCtxUpdateMessage(m.context)
+		update.ReplyTo = message.ID
+		m.sendMessage(client, update)
 	case model.ContextUpdate:
 		if message.Error != nil {
 			m.PrintErrString("Out of sync with client! %v", message.Error.Message)
 		}
-		if len(message.Context) == 0 {
+		// In hub mode the context only changes by negotiating.
+		if len(message.Context) == 0 || m.Hub {
 			break
 		}
 
-		for _, item := range message.Context {
-			if item.Key == model.CaseNumber {
-				m.CurrentCase = item.Value
-				break
-			}
-		}
-		m.Context = []model.ContextItem{{Key: model.CaseNumber, Value: m.CurrentCase}}
-	default:
-		m.Printf("Unknown message kind '%v'", message.Kind)
+		m.context = util.CopyContext(message.Context)
 	}
 }
 
-func (m *Manager) ReceiveMessage(client model.Client, msg []byte) {
+// InvalidContextReason is the rejection reason sent when context fails validation.
+func InvalidContextReason(err error) string {
+	return fmt.Sprintf("Invalid context: %v.", err)
+}
+
+// sendError tells the client it sent an unexpected or invalid message by sending a ctx-update with the current context
+// and an error.
+func (m *Manager) sendError(client model.Client, replyTo string, errorMessage string, status model.StatusCode) {
+	message := util.NewCtxUpdateErrorMessage(m.context, errorMessage, status)
+	message.ReplyTo = replyTo
+	m.sendMessage(client, message)
+}
+
+func (m *Manager) receiveMessage(client model.Client, msg []byte) {
 	var message model.Message
 	err := json.Unmarshal(msg, &message)
 	if err != nil {
 		m.PrintErr(err, "error unmarshalling received message: %v", string(msg))
+		m.sendError(client, "", fmt.Sprintf("Invalid message: %v.", err), model.BadRequest)
 		return
 	}
 
-	messageStr, err := util.PrettyPrintMessage(message)
-	if err != nil {
-		m.PrintErr(err, "error failed to print message on receive")
-	} else {
-		m.Printf("\033[93mReceived\033[0m message: '%v' from '%v' with payload\n%v", message.Kind, client.Application(), messageStr)
-	}
+	m.Publish(model.Event{Kind: model.EventMessageReceived, ClientID: client.ID(), Application: client.Application(), Message: &message})
 
-	m.HandleMessage(client, message)
+	m.handleMessage(client, message)
 }
 
-func (m *Manager) SendMessage(client model.Client, message model.Message) {
+func (m *Manager) sendMessage(client model.Client, message model.Message) {
+	if message.ID == "" {
+		message.ID = util.NewMessageID()
+	}
+	if message.Info != nil && (message.Kind == model.SyncAccept || message.Kind == model.SyncReject) {
+		message.Info.Capabilities = CAPABILITIES
+	}
+
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
 		m.PrintErr(err, "error could not marshal message to send")
 		return
 	}
 
-	messageStr, err := util.PrettyPrintMessage(message)
-	if err != nil {
-		m.PrintErr(err, "error failed to print message on send")
-	} else {
-		m.Printf("\033[92mSending\033[0m message: '%v' to '%v' with payload\n%v", message.Kind, client.Application(), messageStr)
-	}
+	m.Publish(model.Event{Kind: model.EventMessageSent, ClientID: client.ID(), Application: client.Application(), Message: &message})
 
 	client.SendMessage(messageBytes)
 }
 
-func (m *Manager) Accept() {
-	m.CurrentCase = m.VoteCase
-	m.Context = []model.ContextItem{{Key: model.CaseNumber, Value: m.CurrentCase}}
+// accept accepts the request the user is voting on. It returns a *VetoError when a guard vetoes the change, or the
+// navigator's error when the LIS can't switch, in both cases the request is rejected instead.
+func (m *Manager) accept() error {
+	if n := m.negotiation; n != nil {
+		if rejection := m.guard(m.applicationOf(n.originator), n.context); rejection != nil {
+			m.recordVote(LOCAL_PARTICIPANT, voteRejected, rejection)
+			return &VetoError{Rejection: *rejection}
+		}
+		if err := m.navigate(n.context); err != nil {
+			m.recordVote(LOCAL_PARTICIPANT, voteRejected, &model.MessageRejection{Reason: NavigationFailedReason(n.context, err), Status: model.ServerError})
+			return err
+		}
+
+		m.recordVote(LOCAL_PARTICIPANT, voteAccepted, nil)
+		return nil
+	}
+
+	if rejection := m.guard(m.applicationOf(m.syncedClientID), m.voteContext); rejection != nil {
+		m.rejectVote(rejection.Reason, rejection.Status)
+		return &VetoError{Rejection: *rejection}
+	}
+	if err := m.navigate(m.voteContext); err != nil {
+		m.rejectVote(NavigationFailedReason(m.voteContext, err), model.ServerError)
+		return err
+	}
+
+	m.context = util.CopyContext(m.voteContext)
 
-	m.Voting = false
-	m.VoteContext = []model.ContextItem{}
-	m.VoteCase = ""
+	voteID := m.voteID
+	m.clearVote()
 
-	client := m.Clients[m.SyncedClientID]
-	message := util.NewCtxAcceptMessage(m.Context)
-	m.SendMessage(client, message)
+	client := m.clients[m.syncedClientID]
+	m.setSyncedState(client)
+	message := util.NewCtxAcceptMessage(m.context)
+	message.ReplyTo = voteID
+	m.sendMessage(client, message)
+	return nil
 }
 
-func (m *Manager) Reject() {
-	client := m.Clients[m.SyncedClientID]
-	message := util.NewCtxRejectMessage(m.Context, m.VoteContext, "User rejected context change.", model.BadRequest) // Or other reason.
-	m.SendMessage(client, message)
+func (m *Manager) reject() {
+	reason := "User rejected context change." // Or other reason.
+	status := model.BadRequest
+	if m.negotiation != nil {
+		m.recordVote(LOCAL_PARTICIPANT, voteRejected, &model.MessageRejection{Reason: reason, Status: status})
+		return
+	}
 
-	m.Voting = false
-	m.VoteContext = []model.ContextItem{}
-	m.VoteCase = ""
+	if m.collision {
+		reason = OUTSTANDING_REQUEST_REASON
+		status = model.Conflict
+	}
+
+	m.rejectVote(reason, status)
 }
 
-func (m *Manager) ContextChangeRequest(caseNumber string) {
-	if m.SyncedClientID == "" {
+// rejectWith rejects the request the user is voting on, in hub mode as the local participant's vote.
+func (m *Manager) rejectWith(rejection *model.MessageRejection) {
+	if m.negotiation != nil {
+		m.recordVote(LOCAL_PARTICIPANT, voteRejected, rejection)
 		return
 	}
 
-	message := util.NewCtxChangeMessage(caseNumber)
-	m.VoteContext = message.Context
-	m.VoteCase = caseNumber
+	m.rejectVote(rejection.Reason, rejection.Status)
+}
+
+// rejectVote sends a ctx-change-reject for the client's request the user is voting on.
+func (m *Manager) rejectVote(reason string, status model.StatusCode) {
+	client := m.clients[m.syncedClientID]
+	message := util.NewCtxRejectMessage(m.context, m.voteContext, reason, status)
+	message.ReplyTo = m.voteID
+	m.sendMessage(client, message)
+
+	if m.collision {
+		m.PrintErrString("Out of sync with '%v'! Both context change requests were rejected.", client.Application())
+	}
 
-	client := m.Clients[m.SyncedClientID]
-	m.SendMessage(client, message)
+	m.clearVote()
+	m.setSyncedState(client)
 }
 
-func (m *Manager) ListenForDisconnect() {
-	for client := range m.disconnect {
-		m.Printf("Application \033[94m'%v'\033[0m disconnected", client.Application())
-		delete(m.Clients, client.ID())
-		if m.SyncedClientID == client.ID() {
-			m.SyncedClientID = ""
+func (m *Manager) contextChangeRequest(context []model.ContextItem) {
+	if m.syncedClientID == "" {
+		return
+	}
 
-			// If there are other clients connected pick one to become the new synchronized client.
-			// In this example the client we pick is random but it could be done on a FIFO basis.
-			// Or a client could be picked for whatever reason.
-			for _, nextClient := range m.Clients {
-				timeout := (time.Second * DEFAULT_TIMEOUT).Seconds()
-				m.SyncedClientID = nextClient.ID()
-				message := util.NewSubAcceptMessage(APPLICATION_NAME, &timeout, m.CurrentCase)
-				m.SendMessage(nextClient, message)
-				break
-			}
-		}
+	client := m.clients[m.syncedClientID]
+	if client.State() != model.ClientSynced {
+		m.PrintErrString("Can't request a context change while '%v' is %v", client.Application(), client.State())
+		return
+	}
+
+	if err := m.Keys.Validate(context); err != nil {
+		m.PrintErr(err, "error invalid context")
+		return
+	}
+
+	message := util.NewCtxChangeMessage(util.CopyContext(context))
+	message.ID = util.NewMessageID()
+	client.SetTransaction(message.ID)
+	m.outstanding = true
+	m.outstandingContext = message.Context
+
+	m.setSyncedState(client)
+	m.sendMessage(client, message)
+	m.startOutstandingTimer()
+}
 
-		client.Close()
+// repliesToOutstanding reports whether an accept or reject answers our outstanding request. The client's transaction
+// holds the id of that request. Clients that omit reply_to are matched to the only request we have outstanding.
+func (m *Manager) repliesToOutstanding(client model.Client, message model.Message) bool {
+	if message.ReplyTo == "" || message.ReplyTo == client.Transaction() {
+		return true
 	}
+
+	m.PrintErrString("'%v' replied to unknown request '%v'", client.Application(), message.ReplyTo)
+	m.sendError(client, message.ID, fmt.Sprintf("%v replies to unknown request '%v'.", message.Kind, message.ReplyTo), model.BadRequest)
+	return false
+}
+
+// setSyncedState sets the state of the synchronized client from the requests that are in flight. Our outstanding
+// request takes precedence over the client's request because the client still owes us an answer.
+func (m *Manager) setSyncedState(client model.Client) {
+	if client == nil {
+		return
+	}
+
+	switch {
+	case m.outstanding:
+		m.setState(client, model.ClientOutstandingRequest)
+	case m.voting:
+		m.setState(client, model.ClientVoting)
+	default:
+		m.setState(client, model.ClientSynced)
+	}
+}
+
+func (m *Manager) clearVote() {
+	stopTimer(m.voteTimer)
+	m.voteTimer = nil
+	m.voting = false
+	m.collision = false
+	m.voteID = ""
+	m.voteRule = ""
+	m.voteContext = []model.ContextItem{}
+}
+
+func (m *Manager) clearOutstanding() {
+	stopTimer(m.outstandingTimer)
+	m.outstandingTimer = nil
+	if client := m.clients[m.syncedClientID]; client != nil {
+		client.SetTransaction("")
+	}
+	m.outstanding = false
+	m.outstandingContext = []model.ContextItem{}
+}
+
+func (m *Manager) handleDisconnect(client model.Client) {
+	delete(m.clients, client.ID())
+	delete(m.clientInfo, client.ID())
+	m.order = slices.DeleteFunc(m.order, func(id string) bool { return id == client.ID() })
+	m.publishClientEvent(model.EventClientDisconnected, client)
+	if m.Hub {
+		m.leaveNegotiation(client)
+	}
+	if m.syncedClientID == client.ID() {
+		m.syncedClientID = ""
+		m.clearVote()
+		m.clearOutstanding()
+
+		// If there are other clients connected the selection policy picks one to become the new synchronized client.
+		m.promoteNext(SelectOnDisconnect)
+	}
+
+	client.Close()
 }
 
 func (m *Manager) Disconnect() chan model.Client {
@@ -0,0 +1,622 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+type fakeClient struct {
+	id          string
+	application string
+	transaction string
+	state       model.ClientState
+	version     float64
+	sent        []model.Message
+	closed      bool
+	closeCode   int
+}
+
+func newFakeClient(id string) *fakeClient {
+	return &fakeClient{id: id, application: "Fusion", state: model.ClientConnected}
+}
+
+func (c *fakeClient) SendMessage(msg []byte) {
+	var message model.Message
+	if err := json.Unmarshal(msg, &message); err != nil {
+		panic(err)
+	}
+	c.sent = append(c.sent, message)
+}
+
+func (c *fakeClient) Close()                            { c.CloseWithReason(1000, "") }
+func (c *fakeClient) ID() string                        { return c.id }
+func (c *fakeClient) Application() string               { return c.application }
+func (c *fakeClient) SetTransaction(transaction string) { c.transaction = transaction }
+func (c *fakeClient) Transaction() string               { return c.transaction }
+func (c *fakeClient) SetState(state model.ClientState)  { c.state = state }
+func (c *fakeClient) State() model.ClientState          { return c.state }
+func (c *fakeClient) SetVersion(version float64)        { c.version = version }
+func (c *fakeClient) Version() float64                  { return c.version }
+
+func (c *fakeClient) CloseWithReason(code int, reason string) {
+	if !c.closed {
+		c.closed = true
+		c.closeCode = code
+	}
+}
+
+// Flushed is always closed, the fake client writes messages as soon as they are sent.
+func (c *fakeClient) Flushed() <-chan struct{} {
+	flushed := make(chan struct{})
+	close(flushed)
+	return flushed
+}
+
+func (c *fakeClient) last(t *testing.T) model.Message {
+	t.Helper()
+	if len(c.sent) == 0 {
+		t.Fatalf("client %v was not sent any messages", c.id)
+	}
+	return c.sent[len(c.sent)-1]
+}
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(":0", "N123456")
+	go m.Run()
+	t.Cleanup(m.Stop)
+	return m
+}
+
+func connect(t *testing.T, m *Manager, id string) *fakeClient {
+	t.Helper()
+	client := newFakeClient(id)
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1, Application: "Fusion"}})
+	return client
+}
+
+func assertError(t *testing.T, client *fakeClient, status model.StatusCode) {
+	t.Helper()
+	message := client.last(t)
+	if message.Kind != model.ContextUpdate || message.Error == nil || message.Error.Status != status {
+		t.Fatalf("expected ctx-update with error %v, got %+v", status, message)
+	}
+}
+
+func TestSyncRequestTransitions(t *testing.T) {
+	m := newTestManager(t)
+
+	first := connect(t, m, "first")
+	if first.State() != model.ClientSynced || first.last(t).Kind != model.SyncAccept {
+		t.Fatalf("first client should be synced, got %v", first.State())
+	}
+
+	second := connect(t, m, "second")
+	if second.State() != model.ClientWaiting {
+		t.Fatalf("second client should be waiting, got %v", second.State())
+	}
+	if rejection := second.last(t).Rejection; rejection == nil || rejection.Status != model.ConflictWithRetry {
+		t.Fatalf("expected 419 sync-reject, got %+v", second.last(t))
+	}
+
+	m.HandleMessage(first, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1}})
+	assertError(t, first, model.BadRequest)
+}
+
+func TestWaitingClientCannotRequestChange(t *testing.T) {
+	m := newTestManager(t)
+	connect(t, m, "first")
+	second := connect(t, m, "second")
+
+	m.HandleMessage(second, model.Message{Kind: model.ContextChangeRequest, Context: []model.ContextItem{{Key: model.CaseNumber, Value: "N1"}}})
+
+	assertError(t, second, model.BadRequest)
+	if m.voting {
+		t.Fatalf("a waiting client must not start a vote")
+	}
+}
+
+func TestAcceptWithoutOutstandingRequest(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, Context: []model.ContextItem{{Key: model.CaseNumber, Value: "N1"}}})
+
+	assertError(t, client, model.BadRequest)
+	if m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("context must not change, got %v", m.Snapshot().CurrentCase())
+	}
+}
+
+func TestOutstandingRequestRoundTrip(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.ContextChangeRequest(caseContext("N2"))
+	if client.State() != model.ClientOutstandingRequest {
+		t.Fatalf("expected outstanding-request, got %v", client.State())
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, Context: []model.ContextItem{{Key: model.CaseNumber, Value: "N2"}}})
+	if client.State() != model.ClientSynced || m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected synced on N2, got %v on %v", client.State(), m.Snapshot().CurrentCase())
+	}
+}
+
+func TestChangeRequestWithoutClientCopiesContext(t *testing.T) {
+	m := newTestManager(t)
+
+	context := caseContext("N2")
+	m.ContextChangeRequest(context)
+	context[0].Value = "N3"
+
+	if m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected the manager to keep its own copy of N2, got %v", m.Snapshot().CurrentCase())
+	}
+}
+
+func TestEmptyChangeRequest(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest})
+
+	assertError(t, client, model.BadRequest)
+	if client.State() != model.ClientSynced {
+		t.Fatalf("expected synced, got %v", client.State())
+	}
+}
+
+func TestUnknownMessageKind(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: "bogus"})
+
+	assertError(t, client, model.BadRequest)
+}
+
+func TestInvalidJSON(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.ReceiveMessage(client, []byte("{not json"))
+
+	assertError(t, client, model.BadRequest)
+}
+
+func TestMalformedFirstFrame(t *testing.T) {
+	m := newTestManager(t)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { Serve(m, w, r) }))
+	defer httpServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{not json")); err != nil {
+		t.Fatal(err)
+	}
+	var update model.Message
+	if err := conn.ReadJSON(&update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Kind != model.ContextUpdate || update.Error == nil || update.Error.Status != model.BadRequest {
+		t.Fatalf("expected ctx-update with error %v, got %+v", model.BadRequest, update)
+	}
+
+	if err := conn.WriteJSON(util.NewSubRequestMessage("Fusion", 1, false)); err != nil {
+		t.Fatal(err)
+	}
+	var accept model.Message
+	if err := conn.ReadJSON(&accept); err != nil {
+		t.Fatal(err)
+	}
+	if accept.Kind != model.SyncAccept {
+		t.Fatalf("expected the client to be able to sync after the malformed frame, got %+v", accept)
+	}
+}
+
+func caseContext(caseNumber string) []model.ContextItem {
+	return []model.ContextItem{{Key: model.CaseNumber, Value: caseNumber}}
+}
+
+func TestCollisionServerYields(t *testing.T) {
+	m := newTestManager(t)
+	m.CollisionPolicy = CollisionYield
+	client := connect(t, m, "first")
+
+	m.ContextChangeRequest(caseContext("B"))
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("A")})
+
+	if accept := client.last(t); accept.Kind != model.ContextChangeAccept {
+		t.Fatalf("expected ctx-change-accept for A, got %+v", accept)
+	}
+	if client.State() != model.ClientOutstandingRequest {
+		t.Fatalf("client still owes an answer to our request, got %v", client.State())
+	}
+
+	m.HandleMessage(client, model.Message{
+		Kind:      model.ContextChangeReject,
+		Context:   caseContext("B"),
+		Rejection: &model.MessageRejection{Reason: OUTSTANDING_REQUEST_REASON, Status: model.Conflict},
+	})
+
+	if client.State() != model.ClientSynced || m.Snapshot().CurrentCase() != "A" {
+		t.Fatalf("expected synced on A, got %v on %v", client.State(), m.Snapshot().CurrentCase())
+	}
+}
+
+func TestCollisionBothReject(t *testing.T) {
+	m := newTestManager(t)
+	m.CollisionPolicy = CollisionReject
+	client := connect(t, m, "first")
+
+	m.ContextChangeRequest(caseContext("B"))
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("A")})
+
+	reject := client.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.Conflict {
+		t.Fatalf("expected 409 ctx-change-reject, got %+v", reject)
+	}
+
+	m.HandleMessage(client, model.Message{
+		Kind:      model.ContextChangeReject,
+		Context:   caseContext("B"),
+		Rejection: &model.MessageRejection{Reason: OUTSTANDING_REQUEST_REASON, Status: model.Conflict},
+	})
+
+	if client.State() != model.ClientSynced || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected synced on the original case, got %v on %v", client.State(), m.Snapshot().CurrentCase())
+	}
+}
+
+func TestCollisionAsk(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.ContextChangeRequest(caseContext("B"))
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("A")})
+	if !m.voting || !m.collision || !m.outstanding {
+		t.Fatalf("expected the collision to wait for the user")
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("C")})
+	if reject := client.last(t); reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.Conflict {
+		t.Fatalf("a third request must be rejected with 409, got %+v", reject)
+	}
+
+	m.Reject()
+	if reject := client.last(t); reject.Rejection.Status != model.Conflict {
+		t.Fatalf("rejecting during a collision must use 409, got %+v", reject)
+	}
+}
+
+func TestOutstandingRequestTimesOut(t *testing.T) {
+	m := newTestManager(t)
+	m.Timeout = time.Hour
+	client := connect(t, m, "first")
+
+	if timeout := client.last(t).Info.Timeout; timeout == nil || *timeout != time.Hour.Seconds() {
+		t.Fatalf("expected the configured timeout to be advertised, got %v", timeout)
+	}
+
+	m.ContextChangeRequest(caseContext("N2"))
+	m.Do(func() { m.outstandingTimedOut(m.outstandingTimer) })
+
+	update := client.last(t)
+	if update.Kind != model.ContextUpdate || update.Error == nil || update.Error.Status != model.RequestTimeout {
+		t.Fatalf("expected ctx-update with a 408 error, got %+v", update)
+	}
+	if client.State() != model.ClientSynced || m.outstanding {
+		t.Fatalf("expected the request to be cancelled, got %v", client.State())
+	}
+
+	// A late answer is no longer valid.
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, Context: caseContext("N2")})
+	assertError(t, client, model.BadRequest)
+}
+
+func TestVoteTimesOut(t *testing.T) {
+	m := newTestManager(t)
+	m.Timeout = time.Hour
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+	m.Do(func() { m.voteTimedOut(m.voteTimer) })
+
+	reject := client.sent[len(client.sent)-2]
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.RequestTimeout {
+		t.Fatalf("expected 408 ctx-change-reject, got %+v", reject)
+	}
+	if update := client.last(t); update.Kind != model.ContextUpdate {
+		t.Fatalf("expected ctx-update after the rejection, got %+v", update)
+	}
+	if m.voting || client.State() != model.ClientSynced {
+		t.Fatalf("expected the vote to be cancelled")
+	}
+}
+
+func takeover(t *testing.T, m *Manager, id string) *fakeClient {
+	t.Helper()
+	replace := true
+	client := newFakeClient(id)
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1, Application: "Fusion", ReplaceExitingClient: &replace}})
+	return client
+}
+
+func TestTakeoverWait(t *testing.T) {
+	m := newTestManager(t)
+	first := connect(t, m, "first")
+	m.ContextChangeRequest(caseContext("N2"))
+
+	second := takeover(t, m, "second")
+
+	if second.State() != model.ClientSynced || m.syncedClientID != "second" {
+		t.Fatalf("expected the requester to be synced, got %v", second.State())
+	}
+	if rejection := first.last(t).Rejection; first.State() != model.ClientWaiting || rejection == nil || rejection.Status != model.ConflictWithRetry {
+		t.Fatalf("expected the replaced client to wait with a 419, got %v %+v", first.State(), first.last(t))
+	}
+	if m.outstanding {
+		t.Fatalf("requests with the replaced client must be dropped")
+	}
+}
+
+func TestTakeoverClose(t *testing.T) {
+	m := newTestManager(t)
+	m.TakeoverPolicy = TakeoverClose
+	first := connect(t, m, "first")
+
+	takeover(t, m, "second")
+
+	if rejection := first.last(t).Rejection; !first.closed || rejection == nil || rejection.Status != model.Conflict {
+		t.Fatalf("expected the replaced client to be sent a 409 and closed, got %+v", first.last(t))
+	}
+}
+
+func TestTakeoverDeny(t *testing.T) {
+	m := newTestManager(t)
+	m.TakeoverPolicy = TakeoverDeny
+	first := connect(t, m, "first")
+
+	second := takeover(t, m, "second")
+
+	if first.State() != model.ClientSynced || second.State() != model.ClientWaiting {
+		t.Fatalf("expected replace_exiting_client to be ignored, got %v and %v", first.State(), second.State())
+	}
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	// Swap in a copy with a version 2 handler and put the original back after the manager stopped.
+	original := protocolHandlers
+	protocolHandlers = map[float64]func(*Manager, model.Client, model.Message){}
+	for version, handler := range original {
+		protocolHandlers[version] = handler
+	}
+	protocolHandlers[2] = (*Manager).handleMessageV1
+	t.Cleanup(func() { protocolHandlers = original })
+
+	m := newTestManager(t)
+	m.MaxVersion = 2
+
+	maxVersion := 3.0
+	client := newFakeClient("first")
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1, MaxVersion: &maxVersion}})
+
+	if client.Version() != 2 || client.last(t).Info.Version != 2 {
+		t.Fatalf("expected version 2 to be negotiated, got %v", client.Version())
+	}
+}
+
+func TestVersionWithoutHandler(t *testing.T) {
+	m := newTestManager(t)
+	m.MaxVersion = 2
+
+	maxVersion := 1.5
+	first := newFakeClient("first")
+	m.AddClient(first)
+	m.HandleMessage(first, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1, MaxVersion: &maxVersion}})
+	if first.Version() != 1 || first.last(t).Kind != model.SyncAccept {
+		t.Fatalf("expected version 1 to be negotiated, got %v", first.Version())
+	}
+
+	second := newFakeClient("second")
+	m.AddClient(second)
+	m.HandleMessage(second, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1.5}})
+	if reject := second.last(t); reject.Kind != model.SyncReject || reject.Rejection.Status != model.BadRequest {
+		t.Fatalf("expected a 400 sync-reject for a version we don't implement, got %+v", reject)
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	m := newTestManager(t)
+	client := newFakeClient("first")
+	m.AddClient(client)
+
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 2}})
+
+	reject := client.last(t)
+	if reject.Kind != model.SyncReject || reject.Rejection.Status != model.UpgradeRequired {
+		t.Fatalf("expected 426 sync-reject, got %+v", reject)
+	}
+	if reject.Info.MaxVersion == nil || *reject.Info.MaxVersion != MAX_PROTOCOL_VERSION {
+		t.Fatalf("expected the supported range in the reject, got %+v", reject.Info)
+	}
+	if client.State() != model.ClientConnected || m.syncedClientID != "" {
+		t.Fatalf("the client must not be synchronized")
+	}
+}
+
+func TestRepliesAreCorrelated(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, ID: "client-1", Context: caseContext("A")})
+	m.Accept()
+	if accept := client.last(t); accept.ReplyTo != "client-1" || accept.ID == "" {
+		t.Fatalf("expected the accept to reply to client-1, got %+v", accept)
+	}
+
+	m.ContextChangeRequest(caseContext("B"))
+	request := client.last(t)
+	if request.ID == "" || client.Transaction() != request.ID {
+		t.Fatalf("expected our request id to be tracked, got %+v", request)
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, ReplyTo: "stale", Context: caseContext("B")})
+	assertError(t, client, model.BadRequest)
+	if !m.outstanding {
+		t.Fatalf("a reply to another request must not settle ours")
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, ReplyTo: request.ID, Context: caseContext("B")})
+	if m.outstanding || m.Snapshot().CurrentCase() != "B" || client.Transaction() != "" {
+		t.Fatalf("expected our request to be accepted, got %v", m.Snapshot().CurrentCase())
+	}
+}
+
+func TestMultiKeyContextIsPreserved(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	if accept := client.last(t); len(accept.Context) != 3 {
+		t.Fatalf("expected sync-accept to carry the full context, got %+v", accept.Context)
+	}
+
+	requested := []model.ContextItem{
+		{Key: "patient", Value: "p-1"},
+		{Key: "order", Value: "o-1"},
+		{Key: model.CaseNumber, Value: "N1"},
+	}
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: requested})
+	m.Accept()
+
+	if accept := client.last(t); len(accept.Context) != 3 || len(m.context) != 3 || m.Snapshot().CurrentCase() != "N1" {
+		t.Fatalf("expected all keys to be kept, got %+v", m.context)
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextUpdate, Context: []model.ContextItem{
+		{Key: "patient", Value: "p-2"},
+		{Key: model.CaseNumber, Value: "N2"},
+	}})
+	if len(m.context) != 2 || m.context[0].Value != "p-2" || m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected the update to replace the full context, got %+v", m.context)
+	}
+}
+
+func TestInvalidContextIsRejected(t *testing.T) {
+	m := newTestManager(t)
+
+	invalid := newFakeClient("invalid")
+	m.AddClient(invalid)
+	m.HandleMessage(invalid, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1}, Context: []model.ContextItem{{Key: model.Patient, Value: "p-1"}}})
+	if reject := invalid.last(t); reject.Kind != model.SyncReject || reject.Rejection.Status != model.BadRequest {
+		t.Fatalf("expected 400 sync-reject, got %+v", reject)
+	}
+
+	client := connect(t, m, "first")
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: []model.ContextItem{
+		{Key: model.CaseNumber, Value: "N1"},
+		{Key: model.CaseNumber, Value: "N2"},
+	}})
+
+	reject := client.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.BadRequest {
+		t.Fatalf("expected 400 ctx-change-reject, got %+v", reject)
+	}
+	if reject.Rejection.Reason != "Invalid context: context key 'case' appears more than once." {
+		t.Fatalf("unexpected reason %q", reject.Rejection.Reason)
+	}
+	if m.voting {
+		t.Fatalf("invalid context must not start a vote")
+	}
+}
+
+func TestContextEqualityRespectsSystem(t *testing.T) {
+	m := newTestManager(t)
+	client := connect(t, m, "first")
+
+	requested := []model.ContextItem{util.NewIdentifierContextItem(model.CaseNumber, "N1", "lis-a", "accession", "")}
+	m.ContextChangeRequest(requested)
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, Context: []model.ContextItem{
+		util.NewIdentifierContextItem(model.CaseNumber, "N1", "lis-b", "accession", ""),
+	}})
+
+	if update := client.last(t); update.Error == nil || update.Error.Status != model.Conflict {
+		t.Fatalf("expected the same case from another system to be out of sync, got %+v", update)
+	}
+	if m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected the context to be kept, got %v", m.Snapshot().CurrentCase())
+	}
+
+	m.ContextChangeRequest(requested)
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, Context: caseContext("N1")})
+	if m.Snapshot().CurrentCase() != "N1" || m.context[0].System != "lis-a" {
+		t.Fatalf("expected an accept without a system to match, got %+v", m.context)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	m := newTestManager(t)
+	m.AutoAccept = true
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := newFakeClient(fmt.Sprintf("client-%v", i))
+			m.AddClient(client)
+			m.ReceiveMessage(client, []byte(`{"kind": "sync-request", "info": {"version": 1, "application": "Fusion"}}`))
+			m.ReceiveMessage(client, []byte(`{"kind": "ctx-change-request", "context": [{"key": "case", "value": "N1"}]}`))
+			m.Disconnect() <- client
+		}()
+
+		go m.Snapshot()
+	}
+	wg.Wait()
+
+	if snapshot := m.Snapshot(); snapshot.ClientCount != 0 {
+		t.Fatalf("expected every client to be gone, got %v", snapshot.ClientCount)
+	}
+}
+
+func TestManagerPublishesEvents(t *testing.T) {
+	m := newTestManager(t)
+	subscription := m.Events.Subscribe(0)
+	defer subscription.Close()
+
+	connect(t, m, "first")
+
+	var kinds []model.EventKind
+	for len(subscription.C) > 0 {
+		event := <-subscription.C
+		if event.ClientID != "first" {
+			continue
+		}
+		kinds = append(kinds, event.Kind)
+	}
+
+	expected := []model.EventKind{model.EventClientConnected, model.EventStateChanged, model.EventStateChanged, model.EventMessageSent}
+	if fmt.Sprint(kinds) != fmt.Sprint(expected) {
+		t.Fatalf("expected events %v, got %v", expected, kinds)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// Navigator switches the LIS to a context, for example by opening the case in its UI. The manager calls it before it
+// accepts a client's context change request, after a client accepts ours and for the initial context in a
+// sync-request. It is called on the manager goroutine so it should return quickly.
+type Navigator interface {
+	// Navigate switches to the context or returns why it couldn't.
+	Navigate(context []model.ContextItem) error
+	// Current returns the context the LIS is showing, which after a failed Navigate may not be what we asked for.
+	Current() ([]model.ContextItem, error)
+}
+
+// navigate switches the LIS to the context. On failure the current context is set to whatever the LIS reports it is
+// showing, so what we send the client next is the truth. Without a navigator every switch succeeds.
+func (m *Manager) navigate(context []model.ContextItem) error {
+	if m.Navigator == nil {
+		return nil
+	}
+
+	err := m.Navigator.Navigate(util.CopyContext(context))
+	if err == nil {
+		return nil
+	}
+
+	m.PrintErr(err, "error failed to switch to '%v'", util.FormatContext(context))
+	if current, currentErr := m.Navigator.Current(); currentErr == nil {
+		m.context = util.CopyContext(current)
+	} else {
+		m.PrintErr(currentErr, "error failed to get the current context")
+	}
+
+	return err
+}
+
+// NavigationFailedReason is the rejection reason or error message sent when the LIS couldn't switch.
+func NavigationFailedReason(context []model.ContextItem, err error) string {
+	return fmt.Sprintf("Failed to switch to '%v': %v.", util.FormatContext(context), err)
+}
+
+var ErrNavigationFailed = errors.New("injected navigation failure")
+var ErrNoCurrentContext = errors.New("the navigator hasn't switched to any context yet")
+
+// FakeNavigator stands in for the LIS in tests and demos. It switches to any context unless a failure is injected, by
+// case number, at random or for the next switch only.
+type FakeNavigator struct {
+	FailCases []string // Switching to these case numbers fails.
+	FailRate  float64  // The fraction of switches that fail at random, from 0 to 1.
+
+	mu       sync.Mutex
+	current  []model.ContextItem
+	failNext error
+}
+
+func NewFakeNavigator(failCases []string, failRate float64) *FakeNavigator {
+	return &FakeNavigator{FailCases: failCases, FailRate: failRate}
+}
+
+// FailNext makes the next switch fail with err.
+func (n *FakeNavigator) FailNext(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failNext = err
+}
+
+func (n *FakeNavigator) Navigate(context []model.ContextItem) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.failNext; err != nil {
+		n.failNext = nil
+		return err
+	}
+
+	if slices.Contains(n.FailCases, CaseNumberFromContext(context)) {
+		return fmt.Errorf("%w for case '%v'", ErrNavigationFailed, CaseNumberFromContext(context))
+	}
+
+	if n.FailRate > 0 && rand.Float64() < n.FailRate {
+		return ErrNavigationFailed
+	}
+
+	n.current = util.CopyContext(context)
+	return nil
+}
+
+func (n *FakeNavigator) Current() ([]model.ContextItem, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.current == nil {
+		return nil, ErrNoCurrentContext
+	}
+
+	return util.CopyContext(n.current), nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func TestFakeNavigator(t *testing.T) {
+	navigator := NewFakeNavigator([]string{"N666"}, 0)
+
+	if _, err := navigator.Current(); !errors.Is(err, ErrNoCurrentContext) {
+		t.Fatalf("expected no current context, got %v", err)
+	}
+
+	if err := navigator.Navigate(caseContext("N1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := navigator.Navigate(caseContext("N666")); !errors.Is(err, ErrNavigationFailed) {
+		t.Fatalf("expected N666 to fail, got %v", err)
+	}
+
+	injected := errors.New("viewer crashed")
+	navigator.FailNext(injected)
+	if err := navigator.Navigate(caseContext("N2")); err != injected {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+	if err := navigator.Navigate(caseContext("N2")); err != nil {
+		t.Fatalf("expected the injected failure to only apply once, got %v", err)
+	}
+
+	if current, _ := navigator.Current(); CaseNumberFromContext(current) != "N2" {
+		t.Fatalf("expected the navigator to be on N2, got %v", current)
+	}
+}
+
+func newNavigatorManager(t *testing.T, failCases ...string) (*Manager, *FakeNavigator) {
+	t.Helper()
+	m := newTestManager(t)
+	navigator := NewFakeNavigator(failCases, 0)
+	if err := navigator.Navigate(caseContext("N123456")); err != nil {
+		t.Fatal(err)
+	}
+	m.Navigator = navigator
+	return m, navigator
+}
+
+func TestInitialContextNavigationFails(t *testing.T) {
+	m, _ := newNavigatorManager(t, "N666")
+	client := newFakeClient("first")
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1}, Context: caseContext("N666")})
+
+	if len(client.sent) != 2 {
+		t.Fatalf("expected a sync-accept and a ctx-change-request, got %+v", client.sent)
+	}
+	if accept := client.sent[0]; accept.Kind != model.SyncAccept || len(accept.Context) != 0 {
+		t.Fatalf("expected a sync-accept without context, got %+v", accept)
+	}
+	if request := client.sent[1]; request.Kind != model.ContextChangeRequest || CaseNumberFromContext(request.Context) != "N123456" {
+		t.Fatalf("expected a ctx-change-request for our context, got %+v", request)
+	}
+	if client.State() != model.ClientOutstandingRequest || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected our request to be outstanding on N123456, got %v", client.State())
+	}
+}
+
+func TestInitialContextNavigationSucceeds(t *testing.T) {
+	m, navigator := newNavigatorManager(t)
+	client := newFakeClient("first")
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1}, Context: caseContext("N2")})
+
+	current, _ := navigator.Current()
+	if accept := client.last(t); accept.Kind != model.SyncAccept || CaseNumberFromContext(accept.Context) != "N2" || CaseNumberFromContext(current) != "N2" {
+		t.Fatalf("expected to switch to the initial context, got %+v", accept)
+	}
+}
+
+func TestAcceptNavigationFails(t *testing.T) {
+	m, _ := newNavigatorManager(t, "N666")
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N666")})
+	m.Accept()
+
+	reject := client.last(t)
+	if reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.ServerError || reject.ReplyTo != "request-1" {
+		t.Fatalf("expected a 500 ctx-change-reject, got %+v", reject)
+	}
+	if client.State() != model.ClientSynced || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected to stay synced on N123456, got %v on %v", client.State(), m.Snapshot().CurrentCase())
+	}
+}
+
+func TestNavigationFailsAfterClientAccepts(t *testing.T) {
+	m, navigator := newNavigatorManager(t)
+	client := connect(t, m, "first")
+
+	m.ContextChangeRequest(caseContext("N2"))
+	navigator.FailNext(errors.New("LIS is busy"))
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeAccept, ID: "accept-1", Context: caseContext("N2")})
+
+	update := client.last(t)
+	if update.Kind != model.ContextUpdate || update.Error == nil || update.Error.Status != model.ServerError || update.ReplyTo != "accept-1" {
+		t.Fatalf("expected a ctx-update with a 500 error, got %+v", update)
+	}
+	if CaseNumberFromContext(update.Context) != "N123456" || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("expected the ctx-update to carry where we are, got %v", update.Context)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// observe accepts the client as a read-only observer, for example a viewer on a second monitor that follows the current
+// case. Observers don't count against the single synchronized client, any context they send is ignored and they can't
+// request changes.
+func (m *Manager) observe(client model.Client, message model.Message) {
+	m.Printf("Application '%v' is observing", client.Application())
+	m.setState(client, model.ClientObserving)
+	accept := util.NewSubAcceptMessage(APPLICATION_NAME, client.Version(), m.advertisedTimeout(), m.context)
+	accept.ReplyTo = message.ID
+	m.sendMessage(client, accept)
+}
+
+// broadcast publishes a context-changed event and sends the committed context to every observer as a ctx-update when
+// it changed since the last broadcast. Observers that just joined were sent it in their sync-accept.
+func (m *Manager) broadcast() {
+	if slices.Equal(m.context, m.broadcastContext) {
+		return
+	}
+
+	m.broadcastContext = util.CopyContext(m.context)
+	m.Publish(model.Event{Kind: model.EventContextChanged, Context: util.CopyContext(m.context), Text: fmt.Sprintf("Context changed to '%v'", util.FormatContext(m.context))})
+	for _, id := range m.order {
+		client := m.clients[id]
+		if client.State() == model.ClientObserving {
+			m.sendMessage(client, util.NewCtxUpdateMessage(m.context))
+		}
+	}
+}
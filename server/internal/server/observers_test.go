@@ -0,0 +1,94 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func connectObserver(t *testing.T, m *Manager, id string) *fakeClient {
+	t.Helper()
+	client := newFakeClient(id)
+	client.application = "Viewer"
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{
+		Kind:    model.SyncRequest,
+		Info:    &model.ConnectionInfo{Version: 1, Application: "Viewer", Role: model.RoleObserver},
+		Context: caseContext("N999"),
+	})
+	return client
+}
+
+func TestObserverJoinsAlongsideSyncedClient(t *testing.T) {
+	m := newTestManager(t)
+	synced := connect(t, m, "synced")
+	observer := connectObserver(t, m, "observer")
+
+	accept := observer.last(t)
+	if observer.State() != model.ClientObserving || accept.Kind != model.SyncAccept || CaseNumberFromContext(accept.Context) != "N123456" {
+		t.Fatalf("expected the observer to be accepted with the current context, got %v %+v", observer.State(), accept)
+	}
+	if synced.State() != model.ClientSynced || m.Snapshot().CurrentCase() != "N123456" {
+		t.Fatalf("an observer must not change the synchronized client or the context")
+	}
+}
+
+func TestObserverFollowsCommittedContext(t *testing.T) {
+	m := newTestManager(t)
+	synced := connect(t, m, "synced")
+	observer := connectObserver(t, m, "observer")
+	sent := len(observer.sent)
+
+	m.ContextChangeRequest(caseContext("N2"))
+	if len(observer.sent) != sent {
+		t.Fatalf("observers must only be sent committed context, got %+v", observer.last(t))
+	}
+
+	m.HandleMessage(synced, model.Message{Kind: model.ContextChangeAccept, Context: caseContext("N2")})
+	update := observer.last(t)
+	if update.Kind != model.ContextUpdate || CaseNumberFromContext(update.Context) != "N2" {
+		t.Fatalf("expected a ctx-update with N2, got %+v", update)
+	}
+
+	m.HandleMessage(synced, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N3")})
+	m.Accept()
+	if update := observer.last(t); update.Kind != model.ContextUpdate || CaseNumberFromContext(update.Context) != "N3" {
+		t.Fatalf("expected a ctx-update with N3, got %+v", update)
+	}
+}
+
+func TestObserverCannotRequestChanges(t *testing.T) {
+	m := newTestManager(t)
+	connect(t, m, "synced")
+	observer := connectObserver(t, m, "observer")
+
+	m.HandleMessage(observer, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N2")})
+	assertError(t, observer, model.BadRequest)
+	if m.Snapshot().Voting {
+		t.Fatalf("an observer must not start a vote")
+	}
+
+	m.HandleMessage(observer, model.Message{Kind: model.ContextUpdateRequest})
+	if update := observer.last(t); update.Kind != model.ContextUpdate || update.Error != nil {
+		t.Fatalf("expected observers to be able to ask for the context, got %+v", update)
+	}
+}
+
+func TestObserverIsNeverPromoted(t *testing.T) {
+	m := newTestManager(t)
+	synced := connect(t, m, "synced")
+	observer := connectObserver(t, m, "observer")
+
+	m.Do(func() { m.handleDisconnect(synced) })
+	if observer.State() != model.ClientObserving {
+		t.Fatalf("expected the observer to keep observing, got %v", observer.State())
+	}
+
+	next := connect(t, m, "next")
+	if next.State() != model.ClientSynced {
+		t.Fatalf("observers must not count as the synchronized client, got %v", next.State())
+	}
+	if snapshot := m.Snapshot(); snapshot.ObserverCount() != 1 {
+		t.Fatalf("expected one observer, got %+v", snapshot.Clients)
+	}
+}
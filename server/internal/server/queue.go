@@ -0,0 +1,75 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// CAPABILITIES are the optional features this server supports, listed in every sync-accept and sync-reject.
+var CAPABILITIES = []string{model.CapabilityQueuePosition}
+
+// queue is the waiting clients in the order the selection policy would synchronize them, asking it again each time the
+// synchronized client leaves. Clients it wouldn't pick on its own come last, in the order they connected, and are
+// counted in held.
+func (m *Manager) queue() (queue []model.Client, held int) {
+	remaining := m.candidates(nil)
+	queue = make([]model.Client, 0, len(remaining))
+
+	for len(remaining) > 0 {
+		selected := m.SelectionPolicy.Select(SelectOnDisconnect, remaining)
+		if selected == nil {
+			break
+		}
+
+		i := candidateIndex(remaining, selected)
+		if i < 0 {
+			break
+		}
+
+		queue = append(queue, remaining[i].Client)
+		remaining = slices.Delete(remaining, i, i+1)
+	}
+
+	for _, candidate := range remaining {
+		queue = append(queue, candidate.Client)
+	}
+
+	return queue, len(remaining)
+}
+
+// updateQueue works out every waiting client's queue position and sends a queue-update to the clients whose position
+// changed, if they support it. It runs after every command, so it sees the result of anything that could move the queue.
+func (m *Manager) updateQueue() {
+	queue, held := m.queue()
+	ordered := len(queue) - held
+
+	for i, client := range queue {
+		position := model.QueueInfo{Position: i + 1, Size: len(queue), Status: model.QueueQueued}
+		if i == 0 {
+			position.Status = model.QueueNext
+		}
+		if i >= ordered {
+			position.Status = model.QueueHeld
+		}
+
+		info := m.clientInfo[client.ID()]
+		if info.queue == position {
+			continue
+		}
+
+		info.queue = position
+		m.clientInfo[client.ID()] = info
+		if slices.Contains(info.capabilities, model.CapabilityQueuePosition) {
+			m.sendMessage(client, util.NewQueueUpdateMessage(position))
+		}
+	}
+
+	for id, info := range m.clientInfo {
+		if info.queue != (model.QueueInfo{}) && !slices.ContainsFunc(queue, func(client model.Client) bool { return client.ID() == id }) {
+			info.queue = model.QueueInfo{}
+			m.clientInfo[id] = info
+		}
+	}
+}
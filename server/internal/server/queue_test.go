@@ -0,0 +1,76 @@
+package server
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func connectQueued(t *testing.T, m *Manager, id string) *fakeClient {
+	t.Helper()
+	client := newFakeClient(id)
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{
+		Version:      1,
+		Application:  "Fusion",
+		Capabilities: []string{model.CapabilityQueuePosition},
+	}})
+	return client
+}
+
+func assertQueue(t *testing.T, client *fakeClient, position, size int, status model.QueueStatus) {
+	t.Helper()
+	message := client.last(t)
+	if message.Kind != model.QueueUpdate || message.Queue == nil || *message.Queue != (model.QueueInfo{Position: position, Size: size, Status: status}) {
+		t.Fatalf("expected %v queue-update at %v of %v, got %+v", client.id, position, size, message)
+	}
+}
+
+func TestQueuePositions(t *testing.T) {
+	m := newTestManager(t)
+	first := connectQueued(t, m, "first")
+	if accept := first.last(t); !slices.Contains(accept.Info.Capabilities, model.CapabilityQueuePosition) {
+		t.Fatalf("expected the sync-accept to list the server capabilities, got %+v", accept.Info)
+	}
+
+	second := connectQueued(t, m, "second")
+	if reject := second.sent[len(second.sent)-2]; reject.Kind != model.SyncReject {
+		t.Fatalf("expected the 419 before the queue-update, got %+v", reject)
+	}
+	assertQueue(t, second, 1, 1, model.QueueNext)
+
+	third := connectQueued(t, m, "third")
+	assertQueue(t, third, 2, 2, model.QueueQueued)
+	assertQueue(t, second, 1, 2, model.QueueNext)
+
+	m.Do(func() { m.handleDisconnect(first) })
+	if second.last(t).Kind != model.SyncAccept {
+		t.Fatalf("expected second to be synchronized, got %+v", second.last(t))
+	}
+	assertQueue(t, third, 1, 1, model.QueueNext)
+
+	if queue := m.Snapshot().Queue(); len(queue) != 1 || queue[0].ID != "third" {
+		t.Fatalf("unexpected queue %+v", queue)
+	}
+}
+
+func TestQueueHeldByPolicy(t *testing.T) {
+	m := newTestManager(t)
+	m.SelectionPolicy = NeverPolicy{}
+	connectQueued(t, m, "first")
+	second := connectQueued(t, m, "second")
+
+	assertQueue(t, second, 1, 1, model.QueueHeld)
+}
+
+func TestQueueUpdatesNeedCapability(t *testing.T) {
+	m := newTestManager(t)
+	connect(t, m, "first")
+	second := connect(t, m, "second")
+	connect(t, m, "third")
+
+	if message := second.last(t); message.Kind != model.SyncReject {
+		t.Fatalf("a client without the capability must not get queue updates, got %+v", message)
+	}
+}
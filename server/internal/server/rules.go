@@ -0,0 +1,284 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/registry"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// RuleAction is what an accept rule does with a client's context change request.
+type RuleAction string
+
+const (
+	RuleAccept RuleAction = "accept" // Accept the request without asking the user.
+	RuleReject RuleAction = "reject" // Reject the request without asking the user.
+	RuleAsk    RuleAction = "ask"    // Ask the user, even when -auto-accept is on.
+)
+
+// TimeWindow is a daily window in local time, "HH:MM" to "HH:MM". A window whose end is before its start spans midnight.
+type TimeWindow struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AcceptRule decides a client's context change request before the user does. Every condition that is set has to match,
+// a rule without conditions matches every request.
+type AcceptRule struct {
+	Name        string             `json:"name"`
+	Application string             `json:"application,omitempty"`  // The request comes from this application.
+	OnlyChanges []model.ContextKey `json:"only_changes,omitempty"` // The request changes none but these keys.
+	Changes     []model.ContextKey `json:"changes,omitempty"`      // The request changes any of these keys.
+	UnknownKeys bool               `json:"unknown_keys,omitempty"` // The request has keys that aren't registered.
+	Outside     *TimeWindow        `json:"outside,omitempty"`      // The request arrives outside this window.
+	Action      RuleAction         `json:"action"`
+	Reason      string             `json:"reason,omitempty"` // Sent when the rule rejects. Optional.
+	Status      model.StatusCode   `json:"status,omitempty"` // Sent when the rule rejects, 409 when not set.
+}
+
+// LoadAcceptRules reads a JSON file holding an array of accept rules, in the order they are tried.
+func LoadAcceptRules(path string) ([]AcceptRule, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading accept rules: %w", err)
+	}
+
+	var rules []AcceptRule
+	if err := json.Unmarshal(bytes, &rules); err != nil {
+		return nil, fmt.Errorf("parsing accept rules in %v: %w", path, err)
+	}
+
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid accept rule in %v: %w", path, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (rule AcceptRule) validate() error {
+	if rule.Name == "" {
+		return fmt.Errorf("every rule needs a name")
+	}
+
+	switch rule.Action {
+	case RuleAccept, RuleReject, RuleAsk:
+	default:
+		return fmt.Errorf("rule '%v' has unknown action '%v', expected %v, %v or %v", rule.Name, rule.Action, RuleAccept, RuleReject, RuleAsk)
+	}
+
+	if rule.Outside != nil {
+		if _, _, err := rule.Outside.minutes(); err != nil {
+			return fmt.Errorf("rule '%v': %w", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (rule AcceptRule) rejection() *model.MessageRejection {
+	rejection := &model.MessageRejection{Reason: rule.Reason, Status: rule.Status}
+	if rejection.Reason == "" {
+		rejection.Reason = fmt.Sprintf("Rejected by rule '%v'.", rule.Name)
+	}
+	if rejection.Status == 0 {
+		rejection.Status = model.Conflict
+	}
+
+	return rejection
+}
+
+func (rule AcceptRule) matches(change ContextChange, keys *registry.Registry, now time.Time) bool {
+	if rule.Application != "" && rule.Application != change.Application {
+		return false
+	}
+
+	changed := changedKeys(change.From, change.To)
+	if len(rule.OnlyChanges) > 0 && (len(changed) == 0 || slices.ContainsFunc(changed, func(key model.ContextKey) bool { return !slices.Contains(rule.OnlyChanges, key) })) {
+		return false
+	}
+
+	if len(rule.Changes) > 0 && !slices.ContainsFunc(changed, func(key model.ContextKey) bool { return slices.Contains(rule.Changes, key) }) {
+		return false
+	}
+
+	if rule.UnknownKeys && !slices.ContainsFunc(change.To, func(item model.ContextItem) bool {
+		_, ok := keys.Lookup(item.Key)
+		return !ok
+	}) {
+		return false
+	}
+
+	if rule.Outside != nil && rule.Outside.contains(now) {
+		return false
+	}
+
+	return true
+}
+
+func (window TimeWindow) minutes() (from, to int, err error) {
+	start, err := time.Parse("15:04", window.From)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid window start '%v', expected HH:MM", window.From)
+	}
+
+	end, err := time.Parse("15:04", window.To)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid window end '%v', expected HH:MM", window.To)
+	}
+
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+func (window TimeWindow) contains(now time.Time) bool {
+	from, to, err := window.minutes()
+	if err != nil {
+		return false
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+
+	return minute >= from || minute < to
+}
+
+// changedKeys are the keys whose item was added, removed or changed.
+func changedKeys(from, to []model.ContextItem) []model.ContextKey {
+	changed := []model.ContextKey{}
+	for _, item := range to {
+		if previous, ok := util.ItemForKey(from, item.Key); !ok || !util.SameItem(previous, item) {
+			changed = append(changed, item.Key)
+		}
+	}
+
+	for _, item := range from {
+		if _, ok := util.ItemForKey(to, item.Key); !ok {
+			changed = append(changed, item.Key)
+		}
+	}
+
+	return changed
+}
+
+// matchRule returns the first rule that matches the change, or nil.
+func matchRule(rules []AcceptRule, change ContextChange, keys *registry.Registry, now time.Time) *AcceptRule {
+	for i := range rules {
+		if rules[i].matches(change, keys, now) {
+			return &rules[i]
+		}
+	}
+
+	return nil
+}
+
+// RuleResult is what came of a request an accept rule answered.
+type RuleResult string
+
+const (
+	ResultAccepted         RuleResult = "accepted"
+	ResultRejected         RuleResult = "rejected"
+	ResultVetoed           RuleResult = "vetoed"            // The rule accepted but a guard vetoed the change.
+	ResultNavigationFailed RuleResult = "navigation-failed" // The rule accepted but the LIS couldn't switch.
+)
+
+// RuleDecision is a request an accept rule answered without asking the user.
+type RuleDecision struct {
+	Rule        string              `json:"rule"`
+	Action      RuleAction          `json:"action"`
+	Result      RuleResult          `json:"result"`
+	Reason      string              `json:"reason,omitempty"` // Why an accepted request was rejected after all.
+	Context     []model.ContextItem `json:"context"`
+	Application string              `json:"application"`
+}
+
+func (d RuleDecision) String() string {
+	verb := "accepted"
+	if d.Action == RuleReject {
+		verb = "rejected"
+	}
+	str := fmt.Sprintf("Rule '%v' %v '%v' from '%v'", d.Rule, verb, util.FormatContext(d.Context), d.Application)
+
+	switch d.Result {
+	case ResultVetoed:
+		return fmt.Sprintf("%v, but a guard vetoed it: %v", str, d.Reason)
+	case ResultNavigationFailed:
+		return fmt.Sprintf("%v, but the LIS couldn't switch: %v", str, d.Reason)
+	}
+	return str
+}
+
+// answerVote applies the accept rules to the client's request the user is voting on. The request is accepted, rejected
+// or left for the user. Once a rule answered it, the decision and what came of it are published and kept for the TUI.
+// Without a matching rule -auto-accept decides. It reports whether the request was answered.
+func (m *Manager) answerVote() bool {
+	clientID := m.syncedClientID
+	if m.negotiation != nil {
+		clientID = m.negotiation.originator
+	}
+	application := m.applicationOf(clientID)
+
+	change := ContextChange{From: util.CopyContext(m.context), To: util.CopyContext(m.voteContext), Application: application}
+	rule := matchRule(m.AcceptRules, change, m.Keys, time.Now())
+	if rule == nil {
+		if m.AutoAccept {
+			m.accept()
+			return true
+		}
+		m.publishVote(application)
+		return false
+	}
+
+	m.voteRule = rule.Name
+	if rule.Action == RuleAsk {
+		m.Printf("Rule '%v' asks the user about '%v' from '%v'", rule.Name, util.FormatContext(m.voteContext), application)
+		m.publishVote(application)
+		return false
+	}
+
+	decision := RuleDecision{Rule: rule.Name, Action: rule.Action, Result: ResultRejected, Context: util.CopyContext(m.voteContext), Application: application}
+	if rule.Action == RuleAccept {
+		err := m.accept()
+		var veto *VetoError
+		switch {
+		case err == nil:
+			decision.Result = ResultAccepted
+		case errors.As(err, &veto):
+			decision.Result = ResultVetoed
+			decision.Reason = veto.Rejection.Reason
+		default:
+			decision.Result = ResultNavigationFailed
+			decision.Reason = err.Error()
+		}
+	} else {
+		m.rejectWith(rule.rejection())
+	}
+
+	m.lastDecision = &decision
+	m.Publish(model.Event{Kind: model.EventRuleDecided, ClientID: clientID, Application: application, Context: util.CopyContext(decision.Context), Text: decision.String()})
+	return true
+}
+
+// publishVote publishes a change-requested event for the request the user is asked to vote on.
+func (m *Manager) publishVote(application string) {
+	clientID := m.syncedClientID
+	if m.negotiation != nil {
+		clientID = m.negotiation.originator
+	}
+
+	m.Publish(model.Event{
+		Kind:        model.EventChangeRequested,
+		ClientID:    clientID,
+		Application: application,
+		Context:     util.CopyContext(m.voteContext),
+		Text:        fmt.Sprintf("'%v' asks to change context to '%v'", application, util.FormatContext(m.voteContext)),
+	})
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/registry"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+var testRules = []AcceptRule{
+	{Name: "unknown-keys", UnknownKeys: true, Action: RuleReject, Status: model.BadRequest},
+	{Name: "after-hours", Outside: &TimeWindow{From: "07:00", To: "19:00"}, Action: RuleReject, Reason: "The lab is closed."},
+	{Name: "fusion-case-only", Application: "Fusion", OnlyChanges: []model.ContextKey{model.CaseNumber}, Action: RuleAccept},
+	{Name: "patient-change", Changes: []model.ContextKey{model.Patient}, Action: RuleAsk},
+}
+
+func patientCaseContext(patient, caseNumber string) []model.ContextItem {
+	return []model.ContextItem{{Key: model.Patient, Value: patient}, {Key: model.CaseNumber, Value: caseNumber}}
+}
+
+func TestMatchRule(t *testing.T) {
+	day := time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)
+	night := time.Date(2026, 10, 17, 22, 0, 0, 0, time.Local)
+	current := patientCaseContext("p-1", "N1")
+
+	tests := []struct {
+		name   string
+		change ContextChange
+		now    time.Time
+		rule   string
+	}{
+		{"case only from Fusion", ContextChange{From: current, To: patientCaseContext("p-1", "N2"), Application: "Fusion"}, day, "fusion-case-only"},
+		{"case only from another application", ContextChange{From: current, To: patientCaseContext("p-1", "N2"), Application: "Viewer"}, day, ""},
+		{"patient change from Fusion", ContextChange{From: current, To: patientCaseContext("p-2", "N2"), Application: "Fusion"}, day, "patient-change"},
+		{"no change", ContextChange{From: current, To: current, Application: "Fusion"}, day, ""},
+		{"unknown key", ContextChange{From: current, To: append(patientCaseContext("p-1", "N2"), model.ContextItem{Key: "doodad", Value: "1"}), Application: "Fusion"}, day, "unknown-keys"},
+		{"after hours", ContextChange{From: current, To: patientCaseContext("p-1", "N2"), Application: "Fusion"}, night, "after-hours"},
+	}
+
+	for _, test := range tests {
+		rule := matchRule(testRules, test.change, registry.Default(), test.now)
+		name := ""
+		if rule != nil {
+			name = rule.Name
+		}
+		if name != test.rule {
+			t.Fatalf("%v: expected rule '%v', got '%v'", test.name, test.rule, name)
+		}
+	}
+}
+
+func TestTimeWindowSpansMidnight(t *testing.T) {
+	window := TimeWindow{From: "22:00", To: "06:00"}
+	if !window.contains(time.Date(2026, 10, 17, 23, 30, 0, 0, time.Local)) || !window.contains(time.Date(2026, 10, 17, 5, 0, 0, 0, time.Local)) {
+		t.Fatalf("expected the night to be inside the window")
+	}
+	if window.contains(time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)) {
+		t.Fatalf("expected noon to be outside the window")
+	}
+}
+
+func TestLoadAcceptRules(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "rules.json")
+	os.WriteFile(valid, []byte(`[{"name": "fusion-case-only", "application": "Fusion", "only_changes": ["case"], "action": "accept"}]`), 0o644)
+	rules, err := LoadAcceptRules(valid)
+	if err != nil || len(rules) != 1 || rules[0].OnlyChanges[0] != model.CaseNumber {
+		t.Fatalf("expected the rule to load, got %+v %v", rules, err)
+	}
+
+	for _, invalid := range []string{
+		`[{"action": "accept"}]`,
+		`[{"name": "maybe", "action": "perhaps"}]`,
+		`[{"name": "night", "outside": {"from": "7am", "to": "19:00"}, "action": "reject"}]`,
+	} {
+		path := filepath.Join(dir, "invalid.json")
+		os.WriteFile(path, []byte(invalid), 0o644)
+		if _, err := LoadAcceptRules(path); err == nil {
+			t.Fatalf("expected %v to be rejected", invalid)
+		}
+	}
+}
+
+func TestAcceptRulesDecideRequests(t *testing.T) {
+	m := newTestManager(t)
+	m.AutoAccept = true
+	m.AcceptRules = []AcceptRule{testRules[0], testRules[2], testRules[3]}
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: patientCaseContext("p-123456", "N2")})
+	if accept := client.last(t); accept.Kind != model.ContextChangeAccept || m.Snapshot().CurrentCase() != "N2" {
+		t.Fatalf("expected the case change to be accepted, got %+v", accept)
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, ID: "request-2", Context: append(patientCaseContext("p-123456", "N3"), model.ContextItem{Key: "doodad", Value: "1"})})
+	if reject := client.last(t); reject.Kind != model.ContextChangeReject || reject.Rejection.Status != model.BadRequest || reject.Rejection.Reason != "Rejected by rule 'unknown-keys'." {
+		t.Fatalf("expected the unknown key to be rejected, got %+v", reject)
+	}
+
+	sent := len(client.sent)
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, ID: "request-3", Context: patientCaseContext("p-2", "N4")})
+	if state := m.Snapshot(); len(client.sent) != sent || !state.Voting || state.VoteRule != "patient-change" {
+		t.Fatalf("expected the patient change to wait for the user despite auto accept, got %+v", state)
+	}
+
+	m.Accept()
+	if state := m.Snapshot(); state.CurrentCase() != "N4" || state.VoteRule != "" {
+		t.Fatalf("expected the user's accept to switch to N4, got %+v", state)
+	}
+}
+
+func TestAcceptRulesKeepLastDecision(t *testing.T) {
+	m := newTestManager(t)
+	m.AcceptRules = []AcceptRule{testRules[0], testRules[2], testRules[3]}
+	client := connect(t, m, "first")
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: DemoContext("N2")})
+	decision := m.Snapshot().LastDecision
+	if decision == nil || decision.Rule != "fusion-case-only" || decision.Action != RuleAccept || decision.Result != ResultAccepted || decision.Application != "Fusion" {
+		t.Fatalf("expected the accept to be kept, got %+v", decision)
+	}
+	if text := decision.String(); text != "Rule 'fusion-case-only' accepted '"+util.FormatContext(DemoContext("N2"))+"' from 'Fusion'" {
+		t.Fatalf("expected the decision to say which rule fired, got %v", text)
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: append(DemoContext("N3"), model.ContextItem{Key: "doodad", Value: "1"})})
+	if decision := m.Snapshot().LastDecision; decision == nil || decision.Rule != "unknown-keys" || decision.Result != ResultRejected {
+		t.Fatalf("expected the reject to be kept, got %+v", decision)
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: patientCaseContext("p-2", "N4")})
+	m.Accept()
+	if decision := m.Snapshot().LastDecision; decision == nil || decision.Rule != "unknown-keys" {
+		t.Fatalf("expected the user's vote to leave the last decision alone, got %+v", decision)
+	}
+}
+
+func TestAcceptRuleDecisionKeepsTheOutcome(t *testing.T) {
+	m, _ := newNavigatorManager(t, "N666")
+	m.AcceptRules = []AcceptRule{{Name: "accept-all", Action: RuleAccept}}
+	m.Guards = []ContextChangeGuard{GuardFunc(func(change ContextChange) *model.MessageRejection {
+		if CaseNumberFromContext(change.To) == "N13" {
+			return &model.MessageRejection{Reason: "Case is locked."}
+		}
+		return nil
+	})}
+	client := connect(t, m, "first")
+	subscription := m.Events.Subscribe(0)
+	defer subscription.Close()
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N13")})
+	if decision := m.Snapshot().LastDecision; decision == nil || decision.Result != ResultVetoed || decision.Reason != "Case is locked." {
+		t.Fatalf("expected the decision to say the guard vetoed it, got %+v", decision)
+	}
+
+	m.HandleMessage(client, model.Message{Kind: model.ContextChangeRequest, Context: caseContext("N666")})
+	if decision := m.Snapshot().LastDecision; decision == nil || decision.Result != ResultNavigationFailed {
+		t.Fatalf("expected the decision to say the LIS couldn't switch, got %+v", decision)
+	}
+
+	var decided []string
+	for len(subscription.C) > 0 {
+		if event := <-subscription.C; event.Kind == model.EventRuleDecided {
+			decided = append(decided, CaseNumberFromContext(event.Context))
+		}
+	}
+	if fmt.Sprint(decided) != "[N13 N666]" {
+		t.Fatalf("expected an event for every decision, got %v", decided)
+	}
+}
+
+func TestAcceptRulesVoteInHub(t *testing.T) {
+	m, participants := newTestHub(t, QuorumAll, "fusion", "lis")
+	m.AcceptRules = []AcceptRule{{Name: "no-N2", Changes: []model.ContextKey{model.CaseNumber}, Action: RuleReject, Reason: "Not N2."}}
+	fusion := participants[0]
+
+	m.HandleMessage(fusion, model.Message{Kind: model.ContextChangeRequest, ID: "request-1", Context: caseContext("N2")})
+	if reject := fusion.last(t); reject.Kind != model.ContextChangeReject || reject.Rejection.Reason != "Not N2." {
+		t.Fatalf("expected the rule to reject the local vote, got %+v", reject)
+	}
+}
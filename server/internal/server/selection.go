@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// SelectionReason is why the manager is looking for a client to synchronize.
+type SelectionReason string
+
+const (
+	SelectOnDisconnect SelectionReason = "disconnect" // The synchronized client disconnected.
+	SelectOnTakeover   SelectionReason = "takeover"   // A client sent replace_exiting_client in its sync-request.
+	SelectOnPromote    SelectionReason = "promote"    // The user asked to promote a waiting client.
+)
+
+// Candidate is a client that could be synchronized.
+type Candidate struct {
+	Client      model.Client
+	ConnectedAt time.Time
+	LastActive  time.Time // When the client last sent a message.
+	Requested   bool      // The client asked to be synchronized, or the user picked it.
+}
+
+// SelectionPolicy picks the next synchronized client. Candidates are in the order they connected and there is at least
+// one. Returning nil leaves no client synchronized, or denies the takeover.
+type SelectionPolicy interface {
+	Select(reason SelectionReason, candidates []Candidate) model.Client
+}
+
+// FIFOPolicy synchronizes the client that has been waiting the longest.
+type FIFOPolicy struct{}
+
+func (FIFOPolicy) Select(reason SelectionReason, candidates []Candidate) model.Client {
+	if client := requested(candidates); client != nil {
+		return client
+	}
+
+	return candidates[0].Client
+}
+
+// MostRecentlyActivePolicy synchronizes the client that sent a message most recently, it is most likely the one the
+// user is looking at.
+type MostRecentlyActivePolicy struct{}
+
+func (MostRecentlyActivePolicy) Select(reason SelectionReason, candidates []Candidate) model.Client {
+	if client := requested(candidates); client != nil {
+		return client
+	}
+
+	selected := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.LastActive.After(selected.LastActive) {
+			selected = candidate
+		}
+	}
+
+	return selected.Client
+}
+
+// PriorityPolicy synchronizes the client whose Application() comes first in Applications. Applications that aren't
+// listed come after the listed ones, clients with the same priority are taken in the order they connected.
+type PriorityPolicy struct {
+	Applications []string
+}
+
+func (p PriorityPolicy) Select(reason SelectionReason, candidates []Candidate) model.Client {
+	if client := requested(candidates); client != nil {
+		return client
+	}
+
+	selected := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if p.rank(candidate.Client) < p.rank(selected.Client) {
+			selected = candidate
+		}
+	}
+
+	return selected.Client
+}
+
+func (p PriorityPolicy) rank(client model.Client) int {
+	if i := slices.Index(p.Applications, client.Application()); i >= 0 {
+		return i
+	}
+
+	return len(p.Applications)
+}
+
+// NeverPolicy never synchronizes a client on its own. Takeovers are still honored and the user can promote a waiting
+// client by hand.
+type NeverPolicy struct{}
+
+func (NeverPolicy) Select(reason SelectionReason, candidates []Candidate) model.Client {
+	if client := requested(candidates); client != nil {
+		return client
+	}
+
+	if reason == SelectOnPromote {
+		return candidates[0].Client
+	}
+
+	return nil
+}
+
+func requested(candidates []Candidate) model.Client {
+	for _, candidate := range candidates {
+		if candidate.Requested {
+			return candidate.Client
+		}
+	}
+
+	return nil
+}
+
+// ParseSelectionPolicy parses the -next-client flag: fifo, recent, never or priority=App1,App2.
+func ParseSelectionPolicy(policy string) (SelectionPolicy, error) {
+	switch policy {
+	case "fifo":
+		return FIFOPolicy{}, nil
+	case "recent":
+		return MostRecentlyActivePolicy{}, nil
+	case "never":
+		return NeverPolicy{}, nil
+	}
+
+	if applications, ok := strings.CutPrefix(policy, "priority="); ok && applications != "" {
+		return PriorityPolicy{Applications: strings.Split(applications, ",")}, nil
+	}
+
+	return nil, fmt.Errorf("unknown selection policy '%v', expected fifo, recent, never or priority=App1,App2", policy)
+}
+
+// candidates are the waiting clients and the requested client, if any, in the order they connected.
+func (m *Manager) candidates(requestedClient model.Client) []Candidate {
+	candidates := []Candidate{}
+	for _, id := range m.order {
+		client := m.clients[id]
+		isRequested := requestedClient != nil && client.ID() == requestedClient.ID()
+		if !isRequested && client.State() != model.ClientWaiting {
+			continue
+		}
+
+		info := m.clientInfo[id]
+		candidates = append(candidates, Candidate{
+			Client:      client,
+			ConnectedAt: info.connectedAt,
+			LastActive:  info.lastActive,
+			Requested:   isRequested,
+		})
+	}
+
+	return candidates
+}
+
+// selectClient asks the selection policy which of the candidates to synchronize.
+func (m *Manager) selectClient(reason SelectionReason, requestedClient model.Client) model.Client {
+	candidates := m.candidates(requestedClient)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	selected := m.SelectionPolicy.Select(reason, candidates)
+	if selected == nil {
+		return nil
+	}
+
+	// Only trust the policy to pick one of the candidates.
+	if i := candidateIndex(candidates, selected); i >= 0 {
+		return candidates[i].Client
+	}
+
+	m.PrintErrString("selection policy picked '%v' which is not a candidate", selected.ID())
+	return nil
+}
+
+func candidateIndex(candidates []Candidate, client model.Client) int {
+	return slices.IndexFunc(candidates, func(candidate Candidate) bool {
+		return candidate.Client.ID() == client.ID()
+	})
+}
+
+// promoteNext synchronizes the waiting client the selection policy picks, if any.
+func (m *Manager) promoteNext(reason SelectionReason) {
+	if next := m.selectClient(reason, nil); next != nil {
+		m.promote(next)
+	}
+}
+
+// promote makes a waiting client the synchronized client. There must not be a synchronized client already.
+func (m *Manager) promote(client model.Client) {
+	m.Printf("Application '%v' is now the synchronized client", client.Application())
+	m.syncedClientID = client.ID()
+	m.setState(client, model.ClientSynced)
+	m.sendMessage(client, util.NewSubAcceptMessage(APPLICATION_NAME, client.Version(), m.advertisedTimeout(), m.context))
+}
+
+// promoteWaiting replaces the synchronized client, if any, with a waiting client. With no clientID the selection
+// policy picks one. The replaced client is handled like a takeover.
+func (m *Manager) promoteWaiting(clientID string) {
+	var requestedClient model.Client
+	if clientID != "" {
+		requestedClient = m.clients[clientID]
+		if requestedClient == nil || requestedClient.State() != model.ClientWaiting {
+			m.PrintErrString("client '%v' is not waiting and can't be promoted", clientID)
+			return
+		}
+	}
+
+	next := m.selectClient(SelectOnPromote, requestedClient)
+	if next == nil {
+		m.Println("No waiting client to promote")
+		return
+	}
+
+	if m.syncedClientID != "" {
+		m.takeover()
+	}
+	m.promote(next)
+}
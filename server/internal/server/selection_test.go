@@ -0,0 +1,180 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func candidates(apps ...string) []Candidate {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	result := []Candidate{}
+	for i, app := range apps {
+		client := newFakeClient(app)
+		client.application = app
+		result = append(result, Candidate{
+			Client:      client,
+			ConnectedAt: start.Add(time.Duration(i) * time.Minute),
+			LastActive:  start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return result
+}
+
+func TestSelectionPolicies(t *testing.T) {
+	recentlyActive := candidates("a", "b", "c")
+	recentlyActive[1].LastActive = recentlyActive[2].LastActive.Add(time.Minute)
+
+	requested := candidates("a", "b", "c")
+	requested[2].Requested = true
+
+	tests := []struct {
+		name       string
+		policy     SelectionPolicy
+		reason     SelectionReason
+		candidates []Candidate
+		expected   string
+	}{
+		{"fifo", FIFOPolicy{}, SelectOnDisconnect, candidates("a", "b", "c"), "a"},
+		{"fifo requested", FIFOPolicy{}, SelectOnTakeover, requested, "c"},
+		{"recent", MostRecentlyActivePolicy{}, SelectOnDisconnect, recentlyActive, "b"},
+		{"recent requested", MostRecentlyActivePolicy{}, SelectOnPromote, requested, "c"},
+		{"priority", PriorityPolicy{Applications: []string{"c", "b"}}, SelectOnDisconnect, candidates("a", "b", "c"), "c"},
+		{"priority unlisted", PriorityPolicy{Applications: []string{"x"}}, SelectOnDisconnect, candidates("a", "b"), "a"},
+		{"priority requested", PriorityPolicy{Applications: []string{"a"}}, SelectOnTakeover, requested, "c"},
+		{"never", NeverPolicy{}, SelectOnDisconnect, candidates("a", "b"), ""},
+		{"never promote", NeverPolicy{}, SelectOnPromote, candidates("a", "b"), "a"},
+		{"never takeover", NeverPolicy{}, SelectOnTakeover, requested, "c"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := test.policy.Select(test.reason, test.candidates)
+			if test.expected == "" {
+				if selected != nil {
+					t.Fatalf("expected no client, got %v", selected.ID())
+				}
+				return
+			}
+
+			if selected == nil || selected.ID() != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, selected)
+			}
+		})
+	}
+}
+
+func TestParseSelectionPolicy(t *testing.T) {
+	policy, err := ParseSelectionPolicy("priority=Fusion,Viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priority, ok := policy.(PriorityPolicy); !ok || len(priority.Applications) != 2 || priority.Applications[1] != "Viewer" {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+
+	for _, invalid := range []string{"", "random", "priority="} {
+		if _, err := ParseSelectionPolicy(invalid); err == nil {
+			t.Fatalf("expected '%v' to be rejected", invalid)
+		}
+	}
+}
+
+func connectApp(t *testing.T, m *Manager, id, application string) *fakeClient {
+	t.Helper()
+	client := newFakeClient(id)
+	client.application = application
+	m.AddClient(client)
+	m.HandleMessage(client, model.Message{Kind: model.SyncRequest, Info: &model.ConnectionInfo{Version: 1, Application: application}})
+	return client
+}
+
+func TestDisconnectPromotesInOrder(t *testing.T) {
+	m := newTestManager(t)
+	first := connect(t, m, "first")
+	second := connect(t, m, "second")
+	third := connect(t, m, "third")
+
+	m.Do(func() { m.handleDisconnect(first) })
+	if second.State() != model.ClientSynced || second.last(t).Kind != model.SyncAccept {
+		t.Fatalf("expected the longest waiting client to be synchronized, got %v", second.State())
+	}
+	if third.State() != model.ClientWaiting {
+		t.Fatalf("expected the third client to keep waiting, got %v", third.State())
+	}
+}
+
+func TestDisconnectWithPriority(t *testing.T) {
+	m := newTestManager(t)
+	m.SelectionPolicy = PriorityPolicy{Applications: []string{"Viewer"}}
+	first := connectApp(t, m, "first", "Fusion")
+	connectApp(t, m, "second", "Fusion")
+	viewer := connectApp(t, m, "viewer", "Viewer")
+
+	m.Do(func() { m.handleDisconnect(first) })
+	if viewer.State() != model.ClientSynced {
+		t.Fatalf("expected the viewer to be synchronized, got %v", viewer.State())
+	}
+}
+
+func TestNeverPromote(t *testing.T) {
+	m := newTestManager(t)
+	m.SelectionPolicy = NeverPolicy{}
+	first := connect(t, m, "first")
+	second := connect(t, m, "second")
+
+	m.Do(func() { m.handleDisconnect(first) })
+	if second.State() != model.ClientWaiting {
+		t.Fatalf("expected no client to be promoted, got %v", second.State())
+	}
+
+	m.Promote("")
+	if second.State() != model.ClientSynced {
+		t.Fatalf("expected a manual promotion to synchronize the client, got %v", second.State())
+	}
+}
+
+func TestManualPromotion(t *testing.T) {
+	m := newTestManager(t)
+	first := connect(t, m, "first")
+	connect(t, m, "second")
+	third := connect(t, m, "third")
+
+	m.Promote("third")
+	if third.State() != model.ClientSynced || first.State() != model.ClientWaiting {
+		t.Fatalf("expected third synchronized and first waiting, got %v and %v", third.State(), first.State())
+	}
+	if rejection := first.last(t).Rejection; rejection == nil || rejection.Status != model.ConflictWithRetry {
+		t.Fatalf("expected the replaced client to be sent a 419, got %+v", first.last(t))
+	}
+
+	m.Promote("third")
+	if third.State() != model.ClientSynced {
+		t.Fatalf("promoting the synchronized client must not change anything, got %v", third.State())
+	}
+
+	if snapshot := m.Snapshot(); snapshot.WaitingCount() != 2 || snapshot.Clients[2].ID != "third" {
+		t.Fatalf("unexpected snapshot %+v", snapshot.Clients)
+	}
+}
+
+type denyTakeover struct{ FIFOPolicy }
+
+func (p denyTakeover) Select(reason SelectionReason, candidates []Candidate) model.Client {
+	if reason == SelectOnTakeover {
+		return nil
+	}
+	return p.FIFOPolicy.Select(reason, candidates)
+}
+
+func TestPolicyCanDenyTakeover(t *testing.T) {
+	m := newTestManager(t)
+	m.SelectionPolicy = denyTakeover{}
+	first := connect(t, m, "first")
+	second := takeover(t, m, "second")
+
+	if first.State() != model.ClientSynced || second.State() != model.ClientWaiting {
+		t.Fatalf("expected the takeover to be denied, got %v and %v", first.State(), second.State())
+	}
+}
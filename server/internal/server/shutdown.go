@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+const SHUTDOWN_REASON = "Server shutting down"
+
+// Shutdown stops srv accepting connections, closes every client and stops the manager. Clients get a close frame with
+// 1001 going away once their queued messages are written, or the connection is dropped if that takes longer than
+// SHUTDOWN_TIMEOUT.
+func Shutdown(srv *http.Server, manager *Manager) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	if closeErr := manager.Shutdown(ctx); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Shutdown closes every client and waits until their queued messages are written or ctx is done, then stops the
+// manager. Requests in flight are dropped, the clients will sync again when they reconnect.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	var flushed []<-chan struct{}
+	m.Do(func() {
+		m.shuttingDown = true
+		if m.negotiation != nil {
+			m.endNegotiation()
+		}
+		m.clearVote()
+		m.clearOutstanding()
+		m.syncedClientID = ""
+
+		for _, client := range m.clients {
+			m.closeForShutdown(client)
+			flushed = append(flushed, client.Flushed())
+		}
+	})
+
+	defer m.Stop()
+
+	for _, done := range flushed {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) closeForShutdown(client model.Client) {
+	m.setState(client, model.ClientClosing)
+	client.CloseWithReason(websocket.CloseGoingAway, SHUTDOWN_REASON)
+}
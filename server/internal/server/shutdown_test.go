@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownClosesClients(t *testing.T) {
+	m := newTestManager(t)
+	synced := connect(t, m, "synced")
+	waiting := connect(t, m, "waiting")
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range []*fakeClient{synced, waiting} {
+		if !client.closed || client.closeCode != websocket.CloseGoingAway || client.State() != model.ClientClosing {
+			t.Fatalf("expected %v to be closed with 1001, got %v %v", client.id, client.closeCode, client.State())
+		}
+	}
+
+	select {
+	case <-m.Done():
+	default:
+		t.Fatalf("expected the manager to stop")
+	}
+}
+
+func TestShutdownSendsCloseFrame(t *testing.T) {
+	m := newTestManager(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Serve(m, w, r)
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	request := util.NewSubRequestMessage("Fusion", 1, false)
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatal(err)
+	}
+
+	var accept model.Message
+	if err := conn.ReadJSON(&accept); err != nil || accept.Kind != model.SyncAccept {
+		t.Fatalf("expected sync-accept, got %+v %v", accept, err)
+	}
+
+	// Queue a message right before shutting down, it must still be delivered ahead of the close frame.
+	m.ContextChangeRequest(caseContext("N2"))
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var change model.Message
+	if err := conn.ReadJSON(&change); err != nil || change.Kind != model.ContextChangeRequest {
+		t.Fatalf("expected the queued ctx-change-request, got %+v %v", change, err)
+	}
+
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) || !strings.Contains(err.Error(), SHUTDOWN_REASON) {
+		t.Fatalf("expected a 1001 close frame, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import "github.com/Techcyte/context-sync/server/internal/model"
+
+// The message kinds a client may send in each state. Anything not listed here is an invalid transition and is answered
+// with a ctx-update carrying a 400 error, see scenario 4 of the "Context Update" section in the README.
+var allowedMessages = map[model.ClientState][]model.MessageKind{
+	model.ClientConnected: {model.SyncRequest},
+	model.ClientSyncing:   {},
+	model.ClientClosing:   {},
+	model.ClientWaiting:   {model.SyncRequest},
+	model.ClientObserving: {model.ContextUpdateRequest},
+	model.ClientSynced: {
+		model.ContextChangeRequest,
+		model.ContextUpdateRequest,
+		model.ContextUpdate,
+	},
+	model.ClientOutstandingRequest: {
+		model.ContextChangeRequest,
+		model.ContextChangeAccept,
+		model.ContextChangeReject,
+		model.ContextUpdateRequest,
+		model.ContextUpdate,
+	},
+	model.ClientVoting: {
+		model.ContextChangeRequest,
+		model.ContextUpdateRequest,
+		model.ContextUpdate,
+	},
+}
+
+// CanReceive reports whether a client in the given state is allowed to send a message of the given kind.
+func CanReceive(state model.ClientState, kind model.MessageKind) bool {
+	for _, allowed := range allowedMessages[state] {
+		if allowed == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsKnownMessageKind(kind model.MessageKind) bool {
+	switch kind {
+	case model.SyncRequest,
+		model.SyncAccept,
+		model.SyncReject,
+		model.ContextChangeRequest,
+		model.ContextChangeAccept,
+		model.ContextChangeReject,
+		model.ContextUpdateRequest,
+		model.ContextUpdate,
+		model.QueueUpdate:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// TakeoverPolicy decides what happens when a sync-request sets replace_exiting_client while another client is
+// synchronized, for example when a user opens Fusion in a second tab and wants it to take control.
+type TakeoverPolicy string
+
+const (
+	TakeoverWait  TakeoverPolicy = "wait"  // The requester is synchronized, the replaced client is sent a 419 and waits.
+	TakeoverClose TakeoverPolicy = "close" // The requester is synchronized, the replaced client is sent a 409 and closed.
+	TakeoverDeny  TakeoverPolicy = "deny"  // replace_exiting_client is ignored and the requester is sent a 419.
+)
+
+func ParseTakeoverPolicy(policy string) (TakeoverPolicy, error) {
+	switch TakeoverPolicy(policy) {
+	case TakeoverWait, TakeoverClose, TakeoverDeny:
+		return TakeoverPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("unknown takeover policy '%v', expected one of %v, %v or %v", policy, TakeoverWait, TakeoverClose, TakeoverDeny)
+}
+
+func (m *Manager) wantsTakeover(message model.Message) bool {
+	if m.TakeoverPolicy == TakeoverDeny {
+		return false
+	}
+
+	return message.Info != nil && message.Info.ReplaceExitingClient != nil && *message.Info.ReplaceExitingClient
+}
+
+// takeover demotes the synchronized client so the requesting client can be synchronized in its place. Any requests in
+// flight with the demoted client are dropped.
+func (m *Manager) takeover() {
+	client := m.clients[m.syncedClientID]
+	m.clearVote()
+	m.clearOutstanding()
+	m.syncedClientID = ""
+	if client == nil {
+		return
+	}
+
+	m.Printf("Application '%v' was replaced by another client", client.Application())
+
+	if m.TakeoverPolicy == TakeoverClose {
+		m.setState(client, model.ClientClosing)
+		m.sendMessage(client, util.NewSubRejectMessage(APPLICATION_NAME, client.Version(), m.advertisedTimeout(), "Replaced by another client.", model.Conflict))
+		client.Close()
+		return
+	}
+
+	m.setState(client, model.ClientWaiting)
+	m.sendMessage(client, util.NewSubRejectMessage(APPLICATION_NAME, client.Version(), m.advertisedTimeout(), "Replaced by another client.", model.ConflictWithRetry))
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+// advertisedTimeout is the timeout in seconds sent to clients in sync-accept and sync-reject messages.
+func (m *Manager) advertisedTimeout() *float64 {
+	if m.Timeout <= 0 {
+		return nil
+	}
+
+	timeout := m.Timeout.Seconds()
+	return &timeout
+}
+
+func (m *Manager) startOutstandingTimer() {
+	if m.Timeout <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(m.Timeout, func() {
+		m.post(func() {
+			m.outstandingTimedOut(timer)
+		})
+	})
+	m.outstandingTimer = timer
+}
+
+func (m *Manager) startVoteTimer() {
+	if m.Timeout <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(m.Timeout, func() {
+		m.post(func() {
+			m.voteTimedOut(timer)
+		})
+	})
+	m.voteTimer = timer
+}
+
+// outstandingTimedOut cancels our context change request when the client didn't answer it in time. The client is sent
+// our current context so both sides know where they stand.
+func (m *Manager) outstandingTimedOut(timer *time.Timer) {
+	if !m.outstanding || m.outstandingTimer != timer {
+		return // The request was answered or replaced before the timer fired.
+	}
+
+	client := m.clients[m.syncedClientID]
+	m.PrintErrString("Context change request for '%v' timed out after %v", util.FormatContext(m.outstandingContext), m.Timeout)
+	if client == nil {
+		m.clearOutstanding()
+		return
+	}
+
+	requestedContext := util.FormatContext(m.outstandingContext)
+	requestID := client.Transaction()
+	m.clearOutstanding()
+
+	m.setSyncedState(client)
+	message := util.NewCtxUpdateErrorMessage(m.context, fmt.Sprintf("%v for '%v' timed out.", model.ContextChangeRequest, requestedContext), model.RequestTimeout)
+	message.ReplyTo = requestID
+	m.sendMessage(client, message)
+}
+
+// voteTimedOut rejects the client's context change request with a 408 when it wasn't accepted or rejected in time, then
+// sends our current context to resync.
+func (m *Manager) voteTimedOut(timer *time.Timer) {
+	if !m.voting || m.voteTimer != timer {
+		return // The user already voted.
+	}
+
+	client := m.clients[m.syncedClientID]
+	m.PrintErrString("Context change request for '%v' timed out after %v", util.FormatContext(m.voteContext), m.Timeout)
+	rejectedContext := m.voteContext
+	voteID := m.voteID
+	m.clearVote()
+	if client == nil {
+		return
+	}
+
+	m.setSyncedState(client)
+	reject := util.NewCtxRejectMessage(m.context, rejectedContext, "Context change request timed out.", model.RequestTimeout)
+	reject.ReplyTo = voteID
+	m.sendMessage(client, reject)
+	m.sendMessage(client, util.NewCtxUpdateMessage(m.context))
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/util"
+)
+
+const (
+	MIN_PROTOCOL_VERSION = 1
+	MAX_PROTOCOL_VERSION = 1
+)
+
+// protocolHandlers maps a negotiated protocol version to the handler for every message after the sync-request. A new
+// protocol revision adds its handler here instead of branching inside an existing one.
+var protocolHandlers = map[float64]func(*Manager, model.Client, model.Message){
+	1: (*Manager).handleMessageV1,
+}
+
+// negotiateVersion picks the highest protocol version both sides support that we have a handler for. The client
+// supports everything from info.version up to info.max_version, or only info.version when max_version is omitted. When
+// there is none it returns the status to reject the client with: 426 when the ranges don't overlap, so the client knows
+// to upgrade, and 400 when they do but no version in between is one we implement.
+func (m *Manager) negotiateVersion(info *model.ConnectionInfo) (float64, model.StatusCode) {
+	if info == nil {
+		return 0, model.BadRequest
+	}
+
+	clientMax := info.Version
+	if info.MaxVersion != nil {
+		clientMax = *info.MaxVersion
+	}
+
+	low := math.Max(info.Version, m.MinVersion)
+	high := math.Min(clientMax, m.MaxVersion)
+	if high < low {
+		return 0, model.UpgradeRequired
+	}
+
+	version, found := 0.0, false
+	for handled := range protocolHandlers {
+		if handled >= low && handled <= high && (!found || handled > version) {
+			version, found = handled, true
+		}
+	}
+	if !found {
+		return 0, model.BadRequest
+	}
+
+	return version, 0
+}
+
+// rejectVersion sends a sync-reject when the sync-request has no info or no protocol version in common with us. The
+// reject carries the range we support so the client knows what to upgrade to.
+func (m *Manager) rejectVersion(client model.Client, info *model.ConnectionInfo, status model.StatusCode) {
+	m.setState(client, model.ClientConnected)
+
+	if info == nil {
+		m.PrintErrString("'%v' sent %v with no info", client.Application(), model.SyncRequest)
+		message := util.NewSubRejectMessage(APPLICATION_NAME, m.MinVersion, m.advertisedTimeout(), fmt.Sprintf("%v sent with no info.", model.SyncRequest), model.BadRequest)
+		m.sendMessage(client, message)
+		return
+	}
+
+	m.PrintErrString("'%v' requested protocol version %v, we support %v to %v", client.Application(), info.Version, m.MinVersion, m.MaxVersion)
+	reason := fmt.Sprintf("Protocol version %v is not supported. Supported versions are %v to %v.", info.Version, m.MinVersion, m.MaxVersion)
+	message := util.NewSubRejectMessage(APPLICATION_NAME, m.MinVersion, m.advertisedTimeout(), reason, status)
+	maxVersion := m.MaxVersion
+	message.Info.MaxVersion = &maxVersion
+	m.sendMessage(client, message)
+}
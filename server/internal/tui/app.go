@@ -0,0 +1,285 @@
+// Package tui is the TUI of the tcs server, it shows what the manager does and lets the user vote on and enter context.
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Techcyte/context-sync/server/internal/certs"
+	"github.com/Techcyte/context-sync/server/internal/events"
+	"github.com/Techcyte/context-sync/server/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/server"
+	"github.com/Techcyte/context-sync/server/internal/util"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type App struct {
+	Manager   *server.Manager
+	Server    *http.Server // Serves the manager, main shuts it down once the TUI quits.
+	Events    *events.Subscription
+	Spinner   spinner.Model
+	Viewport  viewport.Model
+	TextInput textinput.Model
+	Messages  []string
+	State     server.Snapshot // The manager state as of the last update.
+	Quitting  bool
+	Ready     bool
+	Err       error
+}
+
+func NewApp(manager *server.Manager, srv *http.Server) App {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("202"))
+
+	input := textinput.New()
+	input.Placeholder = "Case number or key=value, ..."
+	input.CharLimit = 256
+	input.Width = 32
+
+	return App{
+		Manager:   manager,
+		Server:    srv,
+		Events:    manager.Events.Subscribe(0),
+		Spinner:   s,
+		TextInput: input,
+		Messages:  []string{},
+	}
+}
+
+func (app App) Init() tea.Cmd {
+	go func() {
+		err := app.Server.ListenAndServeTLS(certs.ServerCertFile, certs.ServerKeyFile)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+
+	return tea.Batch(app.Spinner.Tick, textinput.Blink)
+}
+
+func (app App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	const heightOffset = 9
+	inPutFocused := app.TextInput.Focused()
+	app.State = app.Manager.Snapshot()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			if !inPutFocused {
+				app.Quitting = true
+				return app, tea.Quit
+			}
+		case "c":
+			if !inPutFocused {
+				app.ClearLog()
+				return app, nil
+			}
+		case "n":
+			if !inPutFocused {
+				app.TextInput.Focus()
+				return app, nil
+			}
+		case "p":
+			if !inPutFocused {
+				app.Manager.Promote("")
+				return app, nil
+			}
+		case "a":
+			if app.State.Voting {
+				app.Manager.Accept()
+				return app, nil
+			}
+		case "r":
+			if app.State.Voting {
+				app.Manager.Reject()
+				return app, nil
+			}
+		case "esc":
+			app.TextInput.Blur()
+			return app, nil
+		case "enter":
+			if app.TextInput.Focused() {
+				context, err := app.Manager.ContextFromInput(app.TextInput.Value(), app.State.Context)
+				app.TextInput.SetValue("")
+				app.TextInput.Blur()
+				if err != nil {
+					app.Manager.PrintErr(err, "error invalid context")
+					break
+				}
+
+				if err := app.Manager.ContextChangeRequest(context); err != nil {
+					app.Manager.PrintErr(err, "error requesting context change")
+				}
+			}
+
+			return app, nil
+		}
+	case tea.WindowSizeMsg:
+		if !app.Ready {
+			app.Viewport = viewport.New(msg.Width, msg.Height-heightOffset)
+			app.Viewport.YPosition = 6
+			app.Viewport.SetContent("")
+			app.Ready = true
+		} else {
+			app.Viewport.Width = msg.Width
+			app.Viewport.Height = msg.Height - heightOffset
+		}
+	case error:
+		app.Err = msg
+		return app, nil
+	}
+
+	if app.DrainMessages() {
+		app.Viewport.SetContent(strings.Join(app.Messages, "\n"))
+		app.Viewport.GotoBottom()
+	}
+
+	cmds := []tea.Cmd{}
+	var cmd tea.Cmd
+
+	app.Spinner, cmd = app.Spinner.Update(msg)
+	cmds = append(cmds, cmd)
+
+	app.Viewport, cmd = app.Viewport.Update(msg)
+	cmds = append(cmds, cmd)
+
+	app.TextInput, cmd = app.TextInput.Update(msg)
+	cmds = append(cmds, cmd)
+
+	return app, tea.Batch(cmds...)
+}
+
+func (app App) View() string {
+	if app.Err != nil {
+		return app.Err.Error()
+	}
+
+	str := fmt.Sprintf("\n\t⚡️ Context sync manager is running at %v %v", app.Manager.Address, app.Spinner.View())
+	str = fmt.Sprintf("%v\t\tChange context %v", str, app.TextInput.View())
+
+	if app.State.Voting && app.State.Collision {
+		str = fmt.Sprintf("%v\tClient wants '%v' but we requested '%v'. accept theirs <a> * reject both <r>\n", str, app.State.VoteCase(), app.State.OutstandingCase())
+	} else if app.State.Voting && app.State.VoteRule != "" {
+		str = fmt.Sprintf("%v\tChange context to '%v'? Rule '%v' asks you. accept <a> * reject <r>\n", str, util.FormatContext(app.State.VoteContext), app.State.VoteRule)
+	} else if app.State.Voting {
+		str = fmt.Sprintf("%v\tChange context to '%v'? accept <a> * reject <r>\n", str, util.FormatContext(app.State.VoteContext))
+	} else if negotiation := app.State.Negotiation; negotiation != nil {
+		str = fmt.Sprintf("%v\tNegotiating '%v': %v accepted * %v rejected * %v pending\n", str, util.FormatContext(negotiation.Context), negotiation.Accepted, negotiation.Rejected, negotiation.Pending)
+	} else if app.State.Outstanding {
+		str = fmt.Sprintf("%v\tWaiting for the client to change context to '%v'\n", str, util.FormatContext(app.State.OutstandingContext))
+	} else if app.Manager.AutoAccept {
+		str = fmt.Sprintf("%v\t\033[93mAuto accept enabled\033[0m\n", str)
+	} else if len(app.Manager.AcceptRules) > 0 {
+		str = fmt.Sprintf("%v\t\033[93m%v accept rules enabled\033[0m\n", str, len(app.Manager.AcceptRules))
+	} else {
+		str = fmt.Sprintf("%v\n", str)
+	}
+
+	str = fmt.Sprintf("%v\tConnected clients: %v (%v waiting, %v observing)", str, app.State.ClientCount, app.State.WaitingCount(), app.State.ObserverCount())
+	str = fmt.Sprintf("%v\t\t\t\tCurrent context: '%v'\n", str, util.FormatContext(app.State.Context))
+
+	str = fmt.Sprintf("%v\tWaiting queue: %v", str, FormatQueue(app.State.Queue()))
+	if decision := app.State.LastDecision; decision != nil {
+		str = fmt.Sprintf("%v\t\t\t\t%v", str, decision)
+	}
+	str = fmt.Sprintf("%v\n", str)
+
+	for i := 0; i < app.Viewport.Width; i++ {
+		str = fmt.Sprintf("%v─", str)
+	}
+
+	str = fmt.Sprintf("\n%v\n%v\n", str, app.Viewport.View())
+
+	controls := "clear <c> * change context <n> * promote waiting client <p> * quit <q>"
+	lineLen := app.Viewport.Width - len(controls) - 2
+	for range lineLen / 2 {
+		str = fmt.Sprintf("%v─", str)
+	}
+
+	str = fmt.Sprintf("%v┤\033[32m%v\033[0m├", str, controls)
+
+	for range lineLen / 2 {
+		str = fmt.Sprintf("%v─", str)
+	}
+
+	if app.Quitting {
+		return str + "\n"
+	}
+
+	return str
+}
+
+// FormatQueue lists the waiting clients in queue order, for example "1. Fusion (next) * 2. Viewer (queued)".
+func FormatQueue(queue []server.ClientSnapshot) string {
+	if len(queue) == 0 {
+		return "empty"
+	}
+
+	entries := []string{}
+	for _, client := range queue {
+		entries = append(entries, fmt.Sprintf("%v. %v (%v)", client.Queue.Position, client.Application, client.Queue.Status))
+	}
+
+	return strings.Join(entries, " * ")
+}
+
+// DrainMessages moves the events the manager published since the last update into the log. It reports whether there
+// were any.
+func (app *App) DrainMessages() bool {
+	drained := false
+	for {
+		select {
+		case event := <-app.Events.C:
+			msg := fmt.Sprintf("%v: %v", len(app.Messages)+1, FormatEvent(event))
+			app.Messages = append(app.Messages, msg)
+			drained = true
+		default:
+			return drained
+		}
+	}
+}
+
+func (app *App) ClearLog() {
+	app.Viewport.SetContent("")
+	app.Messages = []string{}
+}
+
+// FormatEvent renders an event as a colored line for the TUI log.
+func FormatEvent(event model.Event) string {
+	switch event.Kind {
+	case model.EventMessageReceived, model.EventMessageSent:
+		messageStr, err := util.PrettyPrintMessage(*event.Message)
+		if err != nil {
+			messageStr = fmt.Sprintf("%+v", *event.Message)
+		}
+
+		if event.Kind == model.EventMessageReceived {
+			return fmt.Sprintf("\033[93mReceived\033[0m message: '%v' from '%v' with payload\n%v", event.Message.Kind, event.Application, messageStr)
+		}
+
+		return fmt.Sprintf("\033[92mSending\033[0m message: '%v' to '%v' with payload\n%v", event.Message.Kind, event.Application, messageStr)
+	case model.EventClientConnected:
+		return fmt.Sprintf("Application \033[94m'%v'\033[0m connected", event.Application)
+	case model.EventClientDisconnected:
+		return fmt.Sprintf("Application \033[94m'%v'\033[0m disconnected", event.Application)
+	case model.EventStateChanged:
+		return fmt.Sprintf("\033[2mApplication '%v' is now %v\033[0m", event.Application, event.State)
+	case model.EventError:
+		if event.Err == nil {
+			return fmt.Sprintf("\033[91mError\033[0m: %v", event.Text)
+		}
+
+		return fmt.Sprintf("\033[91mError\033[0m %v: %v", event.Text, event.Err)
+	default:
+		return event.Text
+	}
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+)
+
+func NewContextItem(key model.ContextKey, value string) model.ContextItem {
+	return model.ContextItem{Key: key, Value: value}
+}
+
+// NewIdentifierContextItem returns a context item with a structured identifier. Any of system, idType and display can
+// be empty.
+func NewIdentifierContextItem(key model.ContextKey, value, system, idType, display string) model.ContextItem {
+	return model.ContextItem{
+		Key:     key,
+		Value:   value,
+		System:  system,
+		Type:    idType,
+		Display: display,
+	}
+}
+
+// SameItem reports whether two context items identify the same thing. The keys and values must match, and when both
+// items have a system the systems must match too. An item without a system matches any system so clients that don't
+// send one keep working.
+func SameItem(a, b model.ContextItem) bool {
+	if a.Key != b.Key || a.Value != b.Value {
+		return false
+	}
+
+	if a.System != "" && b.System != "" {
+		return a.System == b.System
+	}
+
+	return true
+}
+
+// ContextEqual reports whether two contexts have the same keys with the same items, in any order.
+func ContextEqual(a, b []model.ContextItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, item := range a {
+		other, ok := ItemForKey(b, item.Key)
+		if !ok || !SameItem(item, other) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ItemForKey(context []model.ContextItem, key model.ContextKey) (model.ContextItem, bool) {
+	for _, item := range context {
+		if item.Key == key {
+			return item, true
+		}
+	}
+
+	return model.ContextItem{}, false
+}
+
+// CopyContext returns a copy of the context so the caller can keep it without sharing the backing array.
+func CopyContext(context []model.ContextItem) []model.ContextItem {
+	if context == nil {
+		return nil
+	}
+
+	return append([]model.ContextItem{}, context...)
+}
+
+// WithContextValue returns a copy of the context with the value for key replaced, or appended if the key is missing.
+// A replaced item keeps its system and type, the display label belonged to the old value so it is dropped.
+func WithContextValue(context []model.ContextItem, key model.ContextKey, value string) []model.ContextItem {
+	updated := CopyContext(context)
+	for i, item := range updated {
+		if item.Key == key {
+			updated[i].Value = value
+			updated[i].Display = ""
+			return updated
+		}
+	}
+
+	return append(updated, NewContextItem(key, value))
+}
+
+// ParseContext parses "key=value" pairs separated by commas or spaces, for example "patient=p-1, case=N123456". A
+// value can be prefixed with its system as "key=system|value".
+func ParseContext(input string) ([]model.ContextItem, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	context := []model.ContextItem{}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("expected key=value but got '%v'", field)
+		}
+
+		item := NewContextItem(model.ContextKey(key), value)
+		if system, systemValue, ok := strings.Cut(value, "|"); ok {
+			item.System = system
+			item.Value = systemValue
+		}
+
+		context = append(context, item)
+	}
+
+	return context, nil
+}
+
+// FormatContext formats the context as "key=value" pairs, the inverse of ParseContext.
+func FormatContext(context []model.ContextItem) string {
+	items := make([]string, 0, len(context))
+	for _, item := range context {
+		if item.System != "" {
+			items = append(items, fmt.Sprintf("%v=%v|%v", item.Key, item.System, item.Value))
+			continue
+		}
+
+		items = append(items, fmt.Sprintf("%v=%v", item.Key, item.Value))
+	}
+
+	return strings.Join(items, ", ")
+}
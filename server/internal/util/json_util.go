@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"tcs/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/model"
 )
 
 func FormatJson(input []byte) (string, error) {
@@ -1,12 +1,19 @@
 package util
 
 import (
-	"tcs/internal/model"
+	"github.com/Techcyte/context-sync/server/internal/model"
+
+	"github.com/google/uuid"
 )
 
-func NewSubRequestMessage(application string, replaceExistingClient bool) model.Message {
+// NewMessageID returns a new ID for the optional "id" field on a message. Replies echo it in "reply_to".
+func NewMessageID() string {
+	return uuid.New().String()
+}
+
+func NewSubRequestMessage(application string, version float64, replaceExistingClient bool) model.Message {
 	info := model.ConnectionInfo{
-		Version:              1,
+		Version:              version,
 		Application:          application,
 		ReplaceExitingClient: &replaceExistingClient,
 	}
@@ -17,20 +24,13 @@ func NewSubRequestMessage(application string, replaceExistingClient bool) model.
 	}
 }
 
-func NewSubAcceptMessage(application string, timeout *float64, caseNumber string) model.Message {
+func NewSubAcceptMessage(application string, version float64, timeout *float64, context []model.ContextItem) model.Message {
 	info := model.ConnectionInfo{
-		Version:     1,
+		Version:     version,
 		Application: application,
 		Timeout:     timeout,
 	}
 
-	var context []model.ContextItem
-	if caseNumber != "" {
-		context = []model.ContextItem{
-			{Key: model.CaseNumber, Value: caseNumber},
-		}
-	}
-
 	return model.Message{
 		Kind:    model.SyncAccept,
 		Info:    &info,
@@ -38,9 +38,9 @@ func NewSubAcceptMessage(application string, timeout *float64, caseNumber string
 	}
 }
 
-func NewSubRejectMessage(application string, timeout *float64, reason string, status model.StatusCode) model.Message {
+func NewSubRejectMessage(application string, version float64, timeout *float64, reason string, status model.StatusCode) model.Message {
 	info := model.ConnectionInfo{
-		Version:     1,
+		Version:     version,
 		Application: application,
 		Timeout:     timeout,
 	}
@@ -57,12 +57,10 @@ func NewSubRejectMessage(application string, timeout *float64, reason string, st
 	}
 }
 
-func NewCtxChangeMessage(caseNumber string) model.Message {
+func NewCtxChangeMessage(context []model.ContextItem) model.Message {
 	return model.Message{
-		Kind: model.ContextChangeRequest,
-		Context: []model.ContextItem{
-			{Key: model.CaseNumber, Value: caseNumber},
-		},
+		Kind:    model.ContextChangeRequest,
+		Context: context,
 	}
 }
 
@@ -92,8 +90,35 @@ func NewCtxRejectMessage(
 	}
 }
 
+func NewCtxUpdateMessage(context []model.ContextItem) model.Message {
+	return model.Message{
+		Kind:    model.ContextUpdate,
+		Context: context,
+	}
+}
+
+func NewCtxUpdateErrorMessage(context []model.ContextItem, errorMessage string, status model.StatusCode) model.Message {
+	messageError := model.MessageError{
+		Message: errorMessage,
+		Status:  status,
+	}
+
+	return model.Message{
+		Kind:    model.ContextUpdate,
+		Context: context,
+		Error:   &messageError,
+	}
+}
+
 func ContextFromCaseNumber(caseNumber string) []model.ContextItem {
 	return []model.ContextItem{
 		{Key: "case", Value: caseNumber},
 	}
 }
+
+func NewQueueUpdateMessage(queue model.QueueInfo) model.Message {
+	return model.Message{
+		Kind:  model.QueueUpdate,
+		Queue: &queue,
+	}
+}
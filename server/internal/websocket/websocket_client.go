@@ -3,55 +3,85 @@ package ws
 import (
 	"encoding/json"
 	"strings"
-	"tcs/internal/model"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+const CLOSE_WAIT = time.Second      // How long to wait for the close frame to be written.
+const WRITE_WAIT = 10 * time.Second // How long a peer may take to take a message before we give up on it.
+const SEND_BUFFER = 1024            // How many messages may queue for a peer before it counts as stalled.
+
 type WebsocketClient struct {
 	id          string
 	application string
 	transaction string
+	state       model.ClientState
+	version     float64
 	manager     model.Manager
 	connection  *websocket.Conn
 	send        chan []byte
+	closeOnce   *sync.Once
+	closed      bool
+	closing     *atomic.Bool  // Set by Close so the read loop doesn't report the connection we closed as an error.
+	closeCode   int           // Written before send is closed, read by the write loop after it.
+	closeReason string        // Written before send is closed, read by the write loop after it.
+	flushed     chan struct{} // Closed when the write loop returns.
 }
 
-func NewWebsocketClient(manager model.Manager, conn *websocket.Conn, msg []byte) (*WebsocketClient, error) {
+// NewWebsocketClient takes the application name from the first message, msg. A message that isn't valid JSON leaves it
+// empty, the manager answers it when it receives the message.
+func NewWebsocketClient(manager model.Manager, conn *websocket.Conn, msg []byte) *WebsocketClient {
 	application := ""
 
-	if len(msg) != 0 {
-		var message model.Message
-		err := json.Unmarshal(msg, &message)
-		if err != nil {
-			manager.PrintErr(err, "error unmarshalling message %v", string(msg))
-			return nil, err
-		}
-
-		if message.Info != nil && message.Info.Application != "" {
-			application = message.Info.Application
-		}
+	var message model.Message
+	if err := json.Unmarshal(msg, &message); err == nil && message.Info != nil {
+		application = message.Info.Application
 	}
 
 	client := &WebsocketClient{
 		id:          uuid.New().String(),
 		application: application,
+		state:       model.ClientConnected,
 		manager:     manager,
 		connection:  conn,
-		send:        make(chan []byte, 1024),
+		send:        make(chan []byte, SEND_BUFFER),
+		closeOnce:   &sync.Once{},
+		closing:     &atomic.Bool{},
+		flushed:     make(chan struct{}),
 	}
 
-	return client, nil
+	return client
 }
 
+// SendMessage queues a message for the write loop. Like Close it is only called from the manager goroutine, messages
+// for a closed client are dropped. It never blocks, a peer that lets the queue fill up is stalled and gets closed so it
+// can't hold up the manager and everyone else with it.
 func (c *WebsocketClient) SendMessage(msg []byte) {
-	c.send <- msg
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		c.manager.Printf("Client %v stopped taking messages, closing it", c.id)
+		c.CloseWithReason(websocket.CloseTryAgainLater, "Too slow to keep up with messages.")
+	}
 }
 
 func (c *WebsocketClient) Read() {
 	defer func() {
-		c.manager.Disconnect() <- c
+		// Once the manager stops nobody is left to handle the disconnect.
+		select {
+		case c.manager.Disconnect() <- c:
+		case <-c.manager.Done():
+		}
 		c.connection.Close()
 	}()
 
@@ -64,6 +94,9 @@ func (c *WebsocketClient) Read() {
 			}
 
 			// Print the error if it's something other than a closed websocket.
+			if c.closing.Load() {
+				return
+			}
 			c.manager.PrintErr(err, "error reading message")
 			return
 		}
@@ -75,6 +108,7 @@ func (c *WebsocketClient) Read() {
 func (c *WebsocketClient) Write() {
 	defer func() {
 		c.connection.Close()
+		close(c.flushed)
 	}()
 
 	for message := range c.send {
@@ -83,6 +117,7 @@ func (c *WebsocketClient) Write() {
 			continue
 		}
 
+		c.connection.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
 		w, err := c.connection.NextWriter(websocket.TextMessage)
 		if err != nil {
 			c.manager.PrintErr(err, "error getting next writer")
@@ -96,10 +131,35 @@ func (c *WebsocketClient) Write() {
 			return
 		}
 	}
+
+	// The queue is drained, say goodbye so the client sees a clean close instead of an abnormal 1006.
+	closeMessage := websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+	err := c.connection.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(CLOSE_WAIT))
+	if err != nil && err != websocket.ErrCloseSent {
+		c.manager.PrintErr(err, "error sending close frame")
+	}
 }
 
+// Close stops the write loop once the queued messages are sent and closes the connection with a normal closure. It is
+// safe to call more than once, the manager closes replaced clients itself and again when their connection drops.
 func (c *WebsocketClient) Close() {
-	close(c.send)
+	c.CloseWithReason(websocket.CloseNormalClosure, "")
+}
+
+// CloseWithReason is Close with the close code and reason sent in the close frame. Only the first call has any effect.
+func (c *WebsocketClient) CloseWithReason(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closed = true
+		c.closing.Store(true)
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.send)
+	})
+}
+
+// Flushed is closed once the write loop has sent everything queued before Close, or gave up on the connection.
+func (c *WebsocketClient) Flushed() <-chan struct{} {
+	return c.flushed
 }
 
 func (c WebsocketClient) ID() string {
@@ -117,3 +177,19 @@ func (c *WebsocketClient) SetTransaction(transaction string) {
 func (c WebsocketClient) Transaction() string {
 	return c.transaction
 }
+
+func (c *WebsocketClient) SetState(state model.ClientState) {
+	c.state = state
+}
+
+func (c WebsocketClient) State() model.ClientState {
+	return c.state
+}
+
+func (c *WebsocketClient) SetVersion(version float64) {
+	c.version = version
+}
+
+func (c WebsocketClient) Version() float64 {
+	return c.version
+}
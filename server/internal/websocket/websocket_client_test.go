@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Techcyte/context-sync/server/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+type fakeManager struct {
+	disconnect chan model.Client
+	done       chan struct{}
+}
+
+func (m *fakeManager) Publish(event model.Event)                          {}
+func (m *fakeManager) Println(msg string)                                 {}
+func (m *fakeManager) Printf(msgFmt string, args ...any)                  {}
+func (m *fakeManager) PrintErr(err error, msgFmt string, args ...any)     {}
+func (m *fakeManager) ReceiveMessage(client model.Client, msg []byte)     {}
+func (m *fakeManager) SendMessage(client model.Client, msg model.Message) {}
+func (m *fakeManager) Disconnect() chan model.Client                      { return m.disconnect }
+func (m *fakeManager) Done() <-chan struct{}                              { return m.done }
+
+// stalledClient returns a client whose peer connected but never reads.
+func stalledClient(t *testing.T) *WebsocketClient {
+	t.Helper()
+	manager := &fakeManager{disconnect: make(chan model.Client, 1), done: make(chan struct{})}
+	clients := make(chan *WebsocketClient, 1)
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		client := NewWebsocketClient(manager, conn, nil)
+		go client.Write()
+		clients <- client
+	}))
+	t.Cleanup(httpServer.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	return <-clients
+}
+
+func TestSendMessageDoesNotBlockOnStalledPeer(t *testing.T) {
+	client := stalledClient(t)
+	message := bytes.Repeat([]byte("x"), 64*1024)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*SEND_BUFFER; i++ {
+			client.SendMessage(message)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SendMessage blocked on a peer that doesn't read")
+	}
+
+	if !client.closed {
+		t.Fatal("expected the stalled client to be closed")
+	}
+}